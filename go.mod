@@ -4,6 +4,8 @@ go 1.22
 
 require (
 	github.com/jonathanhecl/chunker v0.0.0-20240505215025-9de430348d40
+	github.com/marcboeker/go-duckdb v1.7.0
+	github.com/pgvector/pgvector-go v0.1.1
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -13,9 +15,7 @@ require (
 	github.com/google/flatbuffers v23.5.26+incompatible // indirect
 	github.com/klauspost/compress v1.16.7 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.5 // indirect
-	github.com/marcboeker/go-duckdb v1.7.0 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
-	github.com/pgvector/pgvector-go v0.1.1 // indirect
 	github.com/pierrec/lz4/v4 v4.1.18 // indirect
 	github.com/zeebo/xxh3 v1.0.2 // indirect
 	golang.org/x/mod v0.13.0 // indirect
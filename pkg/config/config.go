@@ -2,6 +2,7 @@ package config
 
 // Config represents the full config for the ragoo app
 type Config struct {
+	Server    Server     `json:"server" yaml:"server"`
 	Routes    []Route    `json:"routes" yaml:"routes"`
 	Workflows []Workflow `json:"workflows" yaml:"workflows"`
 	Services  []Service  `json:"services" yaml:"services"`
@@ -11,33 +12,101 @@ type Config struct {
 	Tools     []Tool     `json:"tools" yaml:"tools"`
 }
 
+// Server configures the HTTP server. Timeouts are durations (e.g. "30s"), with ShutdownTimeout
+// bounding how long in-flight requests and importer batches are waited for when stopping. BasePath
+// is prefixed to every route's path, and the server uses TLS if TLSCertFile and TLSKeyFile are set.
+// EnableAdmin adds the /admin endpoints and the error details of /readyz, which have no auth, so
+// should only be enabled where the server is reachable from trusted networks alone. Unset fields
+// take their defaults, see server.New
+type Server struct {
+	Address         string `json:"address" yaml:"address"`
+	TLSCertFile     string `json:"tlsCertFile" yaml:"tlsCertFile"`
+	TLSKeyFile      string `json:"tlsKeyFile" yaml:"tlsKeyFile"`
+	ReadTimeout     string `json:"readTimeout" yaml:"readTimeout"`
+	WriteTimeout    string `json:"writeTimeout" yaml:"writeTimeout"`
+	IdleTimeout     string `json:"idleTimeout" yaml:"idleTimeout"`
+	ShutdownTimeout string `json:"shutdownTimeout" yaml:"shutdownTimeout"`
+	MaxBodyBytes    int64  `json:"maxBodyBytes" yaml:"maxBodyBytes"`
+	BasePath        string `json:"basePath" yaml:"basePath"`
+	EnableAdmin     bool   `json:"enableAdmin" yaml:"enableAdmin"`
+}
+
 type Ref struct {
 	Ref    string            `json:"ref" yaml:"ref"`
 	Params map[string]string `json:"params" yaml:"params"`
 }
 
-// Route represents a route made available on the server and the workflow that gets triggered
+// Route represents a route made available on the server and the workflow that gets triggered.
+// If Stream is set (or the client sends Accept: text/event-stream), the workflow's response is streamed as SSE.
+// The fields of a JSON object request body are passed to the workflow as params, with the field named by
+// Input (if set) used as _input rather than the whole body. Output maps the keys of the JSON response to
+// vars of the workflow (e.g. answer: $_response, refs: $refs.Refs). If Sources names a var holding storage
+// refs, the response includes them as 'sources', with their cosines, matched chunks, and whether the
+// response cited them (by the numbers given by the docs prompt helper)
 type Route struct {
-	Path     string `json:"path" yaml:"path"`
-	Workflow Ref    `json:"workflow" yaml:"workflow"`
+	Path     string            `json:"path" yaml:"path"`
+	Workflow Ref               `json:"workflow" yaml:"workflow"`
+	Stream   bool              `json:"stream" yaml:"stream"`
+	Session  *Session          `json:"session" yaml:"session"`
+	Input    string            `json:"input" yaml:"input"`
+	Output   map[string]string `json:"output" yaml:"output"`
+	Sources  string            `json:"sources" yaml:"sources"`
 }
 
+// Session configures a route to persist its conversation in storage, keyed by a session ID request header.
+// The storage must implement storage.SessionStore, as DuckDB does. The last Turns turns are replayed into
+// the workflow as the _history var, with any older turns condensed into a summary by the Summarize service
+// (if set). The summary is saved with the session, and each turn is folded into it once, as it falls out of
+// the window. Refs names a var whose storage refs are recorded with each turn
+type Session struct {
+	Header    string `json:"header" yaml:"header"`
+	Storage   string `json:"storage" yaml:"storage"`
+	Turns     int    `json:"turns" yaml:"turns"`
+	Summarize string `json:"summarize" yaml:"summarize"`
+	Refs      string `json:"refs" yaml:"refs"`
+}
+
+// Workflow represents a named sequence of stages, optionally bounded by a timeout (e.g. "30s")
 type Workflow struct {
-	Name   string  `json:"name" yaml:"name"`
-	Stages []Stage `json:"stages" yaml:"stages"`
+	Name    string  `json:"name" yaml:"name"`
+	Timeout string  `json:"timeout" yaml:"timeout"`
+	Stages  []Stage `json:"stages" yaml:"stages"`
 }
 
+// Stage represents a group of steps, which are run concurrently if Parallel is set and
+// only if the When expression (if any) is met by the workflow vars
 type Stage struct {
-	Name  string `json:"name" yaml:"name"`
-	Steps []Step `json:"steps" yaml:"steps"`
+	Name     string `json:"name" yaml:"name"`
+	Parallel bool   `json:"parallel" yaml:"parallel"`
+	When     string `json:"when" yaml:"when"`
+	Steps    []Step `json:"steps" yaml:"steps"`
 }
 
+// Step represents a single plugin call, optionally bounded by a timeout (e.g. "10s")
+// and skipped unless the When expression (e.g. len(refs.Refs) > 0) is met. Steps holds
+// the nested steps of a foreach step. A failed step is retried according to Retry, and then
+// OnError decides what happens: "fail" (the default) fails the workflow, "fallback" runs the
+// step with its Fallback ref instead (setting the Error of its var to the original error if the
+// fallback succeeds), and "continue" sets its var to the error and lets the workflow continue
 type Step struct {
-	Type   string            `json:"type" yaml:"type"`
-	Action string            `json:"action" yaml:"action"`
-	Ref    string            `json:"ref" yaml:"ref"`
-	Params map[string]string `json:"params" yaml:"params"`
-	Var    string            `json:"var" yaml:"var"`
+	Type     string            `json:"type" yaml:"type"`
+	Action   string            `json:"action" yaml:"action"`
+	Ref      string            `json:"ref" yaml:"ref"`
+	Params   map[string]string `json:"params" yaml:"params"`
+	Var      string            `json:"var" yaml:"var"`
+	Timeout  string            `json:"timeout" yaml:"timeout"`
+	When     string            `json:"when" yaml:"when"`
+	Steps    []Step            `json:"steps" yaml:"steps"`
+	Retry    *Retry            `json:"retry" yaml:"retry"`
+	OnError  string            `json:"onError" yaml:"onError"`
+	Fallback string            `json:"fallback" yaml:"fallback"`
+}
+
+// Retry configures how many times a failed step is attempted in total, waiting Backoff
+// (e.g. "2s", doubled after each failure) between attempts
+type Retry struct {
+	Attempts int    `json:"attempts" yaml:"attempts"`
+	Backoff  string `json:"backoff" yaml:"backoff"`
 }
 
 // Service represents an LLM service and its configuration
@@ -70,5 +139,12 @@ type Storage struct {
 	Config map[string]string `json:"config" yaml:"config"`
 }
 
-// Tool represents a tool available to a service or workflow
-type Tool struct{}
+// Tool represents a tool available to a service or workflow. Parameters is the
+// JSON schema of the arguments the model must provide when calling the tool
+type Tool struct {
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description" yaml:"description"`
+	Type        string            `json:"type" yaml:"type"`
+	Parameters  Schema            `json:"parameters" yaml:"parameters"`
+	Config      map[string]string `json:"config" yaml:"config"`
+}
@@ -0,0 +1,63 @@
+package config
+
+import "fmt"
+
+// Schema is a JSON schema expressed in YAML
+type Schema map[string]any
+
+// UnmarshalYAML converts the map[interface{}]interface{} values produced by the YAML
+// decoder into map[string]any so that the schema can be encoded as JSON
+func (s *Schema) UnmarshalYAML(unmarshal func(any) error) error {
+	raw := map[string]any{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	for k, v := range raw {
+		conv, err := jsonCompatible(v)
+		if err != nil {
+			return fmt.Errorf("invalid schema key %s: %w", k, err)
+		}
+
+		raw[k] = conv
+	}
+
+	*s = raw
+
+	return nil
+}
+
+func jsonCompatible(val any) (any, error) {
+	switch v := val.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, inner := range v {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("non-string key %v", k)
+			}
+
+			conv, err := jsonCompatible(inner)
+			if err != nil {
+				return nil, err
+			}
+
+			m[key] = conv
+		}
+
+		return m, nil
+	case []any:
+		for i, inner := range v {
+			conv, err := jsonCompatible(inner)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = conv
+		}
+
+		return v, nil
+	}
+
+	return val, nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PrefixedValues collects the keys in cfg that begin with prefix (with the prefix removed),
+// converting each value to an int, float, or bool where possible and leaving it as a string otherwise
+func PrefixedValues(cfg map[string]string, prefix string) map[string]any {
+	vals := map[string]any{}
+
+	for k, v := range cfg {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		vals[strings.TrimPrefix(k, prefix)] = ParseValue(v)
+	}
+
+	return vals
+}
+
+// ParseValue converts val to an int, float, or bool if possible, otherwise returns it unchanged
+func ParseValue(val string) any {
+	if i, err := strconv.Atoi(val); err == nil {
+		return i
+	}
+
+	if f, err := strconv.ParseFloat(val, 64); err == nil {
+		return f
+	}
+
+	if b, err := strconv.ParseBool(val); err == nil {
+		return b
+	}
+
+	return val
+}
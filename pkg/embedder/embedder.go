@@ -1,8 +1,14 @@
 package embedder
 
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
 // Embedder represents an embedder
 type Embedder interface {
-	Generate(input string) (*Result, error)
+	Generate(ctx context.Context, input string) (*Result, error)
 }
 
 // Result is the result of an embedder
@@ -10,11 +16,49 @@ type Result struct {
 	Embedding []float32
 }
 
-func EmbedderOfType(embType string, config map[string]string) Embedder {
-	switch embType {
-	case "ollama":
-		return &ollamaEmbedder{config}
+// Constructor creates an embedder from its config
+type Constructor func(config map[string]string) (Embedder, error)
+
+var (
+	registry = map[string]Constructor{
+		"ollama": func(config map[string]string) (Embedder, error) {
+			emb, err := newOllamaEmbedder(config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to newOllamaEmbedder: %w", err)
+			}
+
+			return emb, nil
+		},
+		"openai": func(config map[string]string) (Embedder, error) {
+			emb, err := newOpenAIEmbedder(config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to newOpenAIEmbedder: %w", err)
+			}
+
+			return emb, nil
+		},
+	}
+	registryLock = sync.RWMutex{} // protect access to the registry for concurrent access
+)
+
+// Register makes an embedder type available for use in config, replacing any existing type with the same name
+func Register(embType string, constructor Constructor) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[embType] = constructor
+}
+
+// EmbedderOfType returns an embedder for the provided type, or an error if
+// the type is unknown or the config is invalid
+func EmbedderOfType(embType string, config map[string]string) (Embedder, error) {
+	registryLock.RLock()
+	constructor, exists := registry[embType]
+	registryLock.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("embedder of type %s not found", embType)
 	}
 
-	return nil
+	return constructor(config)
 }
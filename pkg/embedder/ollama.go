@@ -2,34 +2,85 @@ package embedder
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/health"
 )
 
+const ollamaDefaultBaseURL = "http://localhost:11434"
+
 type ollamaEmbedder struct {
-	config map[string]string
+	baseURL   string
+	model     string
+	keepAlive string
+	options   map[string]any
+	client    *http.Client
 }
 
 type embeddingRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
+	Model     string         `json:"model"`
+	Prompt    string         `json:"prompt"`
+	KeepAlive string         `json:"keep_alive,omitempty"`
+	Options   map[string]any `json:"options,omitempty"`
 }
 
 type embeddingResponse struct {
 	Embedding []float32 `json:"embedding"`
 }
 
+// newOllamaEmbedder creates an ollama embedder from its config, which supports the keys
+// baseURL, model (required), keepAlive, timeout, and any number of options.<name> keys
+func newOllamaEmbedder(cfg map[string]string) (*ollamaEmbedder, error) {
+	model, exists := cfg["model"]
+	if !exists || model == "" {
+		return nil, errors.New("ollama embedder missing config key: model")
+	}
+
+	baseURL := ollamaDefaultBaseURL
+	if url, exists := cfg["baseURL"]; exists {
+		baseURL = strings.TrimSuffix(url, "/")
+	}
+
+	client := &http.Client{}
+	if timeout, exists := cfg["timeout"]; exists {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to ParseDuration for config key 'timeout': %w", err)
+		}
+
+		client.Timeout = dur
+	}
+
+	o := &ollamaEmbedder{
+		baseURL:   baseURL,
+		model:     model,
+		keepAlive: cfg["keepAlive"],
+		options:   config.PrefixedValues(cfg, "options."),
+		client:    client,
+	}
+
+	return o, nil
+}
+
 // Generate generates embeddings for the given input
-func (o *ollamaEmbedder) Generate(input string) (*Result, error) {
-	slog.Info("generating embedding", "embedder", "ollama")
+func (o *ollamaEmbedder) Generate(ctx context.Context, input string) (*Result, error) {
+	slog.Info("generating embedding", "embedder", "ollama", "model", o.model)
 
-	url := "http://localhost:11434/api/embeddings"
+	url := o.baseURL + "/api/embeddings"
 
 	reqBody := &embeddingRequest{
-		Model:  "snowflake-arctic-embed",
-		Prompt: input,
+		Model:     o.model,
+		Prompt:    input,
+		KeepAlive: o.keepAlive,
+		Options:   o.options,
 	}
 
 	reqBytes, err := json.Marshal(reqBody)
@@ -37,22 +88,22 @@ func (o *ollamaEmbedder) Generate(input string) (*Result, error) {
 		return nil, fmt.Errorf("failed to json.Marshal: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(reqBytes))
 	if err != nil {
-		return nil, fmt.Errorf("failed to NewRequest: %w", err)
+		return nil, fmt.Errorf("failed to NewRequestWithContext: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := o.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to Do: %w", err)
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
 	}
 
-	defer resp.Body.Close()
-
 	emb := &embeddingResponse{}
 	if err := json.NewDecoder(resp.Body).Decode(emb); err != nil {
 		return nil, fmt.Errorf("failed to NewDecoder.Decode: %w", err)
@@ -64,3 +115,8 @@ func (o *ollamaEmbedder) Generate(input string) (*Result, error) {
 
 	return r, nil
 }
+
+// Check checks that ollama is reachable and has pulled the configured model
+func (o *ollamaEmbedder) Check(ctx context.Context) error {
+	return health.CheckOllamaModel(ctx, o.client, o.baseURL, o.model)
+}
@@ -0,0 +1,146 @@
+package embedder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cohix/ragoo/pkg/health"
+)
+
+const openAIDefaultBaseURL = "https://api.openai.com/v1"
+
+// openAIEmbedder speaks the OpenAI embeddings wire protocol, which is
+// also served by vLLM, llama.cpp server, LiteLLM, and many other gateways
+type openAIEmbedder struct {
+	baseURL    string
+	model      string
+	apiKey     string
+	dimensions *int
+	client     *http.Client
+}
+
+type openAIEmbeddingRequest struct {
+	Model      string `json:"model"`
+	Input      string `json:"input"`
+	Dimensions *int   `json:"dimensions,omitempty"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// newOpenAIEmbedder creates an openai embedder from its config, which supports the keys
+// baseURL, apiKeyEnv, model (required), dimensions, and timeout
+func newOpenAIEmbedder(cfg map[string]string) (*openAIEmbedder, error) {
+	model, exists := cfg["model"]
+	if !exists || model == "" {
+		return nil, errors.New("openai embedder missing config key: model")
+	}
+
+	baseURL := openAIDefaultBaseURL
+	if url, exists := cfg["baseURL"]; exists {
+		baseURL = strings.TrimSuffix(url, "/")
+	}
+
+	apiKey, err := health.OpenAIAPIKey(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to OpenAIAPIKey: %w", err)
+	}
+
+	client := &http.Client{}
+	if timeout, exists := cfg["timeout"]; exists {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to ParseDuration for config key 'timeout': %w", err)
+		}
+
+		client.Timeout = dur
+	}
+
+	o := &openAIEmbedder{
+		baseURL: baseURL,
+		model:   model,
+		apiKey:  apiKey,
+		client:  client,
+	}
+
+	if dims, exists := cfg["dimensions"]; exists {
+		d, err := strconv.Atoi(dims)
+		if err != nil {
+			return nil, fmt.Errorf("failed to strconv.Atoi for config key 'dimensions' (must be integer): %w", err)
+		}
+
+		o.dimensions = &d
+	}
+
+	return o, nil
+}
+
+// Generate generates embeddings for the given input
+func (o *openAIEmbedder) Generate(ctx context.Context, input string) (*Result, error) {
+	slog.Info("generating embedding", "embedder", "openai", "model", o.model)
+
+	url := o.baseURL + "/embeddings"
+
+	reqBody := &openAIEmbeddingRequest{
+		Model:      o.model,
+		Input:      input,
+		Dimensions: o.dimensions,
+	}
+
+	reqBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to json.Marshal: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to NewRequestWithContext: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Do: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
+	}
+
+	emb := &openAIEmbeddingResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(emb); err != nil {
+		return nil, fmt.Errorf("failed to NewDecoder.Decode: %w", err)
+	}
+
+	if len(emb.Data) == 0 {
+		return nil, errors.New("openai response contained no embeddings")
+	}
+
+	r := &Result{
+		Embedding: emb.Data[0].Embedding,
+	}
+
+	return r, nil
+}
+
+// Check checks that the API is reachable, accepts the API key, and serves the configured model
+func (o *openAIEmbedder) Check(ctx context.Context) error {
+	return health.CheckOpenAIModel(ctx, o.client, o.baseURL, o.apiKey, o.model)
+}
@@ -0,0 +1,187 @@
+package embedder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cohix/ragoo/pkg/health"
+)
+
+// fakeOpenAI serves /embeddings with the given status and body, recording each request
+type fakeOpenAI struct {
+	status int
+	body   string
+
+	auth string
+	req  openAIEmbeddingRequest
+}
+
+func (f *fakeOpenAI) start(t *testing.T) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+
+		f.auth = r.Header.Get("Authorization")
+
+		if err := json.NewDecoder(r.Body).Decode(&f.req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(f.status)
+		fmt.Fprint(w, f.body)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv.URL + "/v1"
+}
+
+func TestOpenAIEmbeddings(t *testing.T) {
+	t.Setenv(health.OpenAIDefaultAPIKeyEnv, "")
+
+	fake := &fakeOpenAI{
+		status: http.StatusOK,
+		body:   `{"data": [{"embedding": [0.25, -0.5, 1]}]}`,
+	}
+
+	emb, err := EmbedderOfType("openai", map[string]string{
+		"baseURL":    fake.start(t) + "/",
+		"model":      "embed-test",
+		"dimensions": "3",
+	})
+	if err != nil {
+		t.Fatalf("failed to EmbedderOfType: %s", err)
+	}
+
+	res, err := emb.Generate(context.Background(), "some text")
+	if err != nil {
+		t.Fatalf("failed to Generate: %s", err)
+	}
+
+	if fmt.Sprint(res.Embedding) != "[0.25 -0.5 1]" {
+		t.Errorf("got embedding %v, want [0.25 -0.5 1]", res.Embedding)
+	}
+
+	if fake.req.Model != "embed-test" || fake.req.Input != "some text" {
+		t.Errorf("got model %q and input %q", fake.req.Model, fake.req.Input)
+	}
+
+	if fake.req.Dimensions == nil || *fake.req.Dimensions != 3 {
+		t.Errorf("got dimensions %v, want 3", fake.req.Dimensions)
+	}
+}
+
+func TestOpenAIAuthHeader(t *testing.T) {
+	cases := []struct {
+		name     string
+		env      map[string]string
+		cfg      map[string]string
+		wantAuth string
+		wantErr  bool
+	}{
+		{
+			name:     "default env var",
+			env:      map[string]string{health.OpenAIDefaultAPIKeyEnv: "sk-default"},
+			wantAuth: "Bearer sk-default",
+		},
+		{
+			name:     "no key for local gateways",
+			env:      map[string]string{health.OpenAIDefaultAPIKeyEnv: ""},
+			wantAuth: "",
+		},
+		{
+			name:     "explicit env var",
+			env:      map[string]string{health.OpenAIDefaultAPIKeyEnv: "sk-default", "RAGOO_TEST_KEY": "sk-explicit"},
+			cfg:      map[string]string{"apiKeyEnv": "RAGOO_TEST_KEY"},
+			wantAuth: "Bearer sk-explicit",
+		},
+		{
+			name:    "explicit env var is empty",
+			env:     map[string]string{"RAGOO_TEST_KEY": ""},
+			cfg:     map[string]string{"apiKeyEnv": "RAGOO_TEST_KEY"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			fake := &fakeOpenAI{status: http.StatusOK, body: `{"data": [{"embedding": [1]}]}`}
+
+			cfg := map[string]string{"baseURL": fake.start(t), "model": "embed-test"}
+			for k, v := range tc.cfg {
+				cfg[k] = v
+			}
+
+			emb, err := EmbedderOfType("openai", cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("EmbedderOfType succeeded, want error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to EmbedderOfType: %s", err)
+			}
+
+			if _, err := emb.Generate(context.Background(), "hi"); err != nil {
+				t.Fatalf("failed to Generate: %s", err)
+			}
+
+			if fake.auth != tc.wantAuth {
+				t.Errorf("got Authorization %q, want %q", fake.auth, tc.wantAuth)
+			}
+		})
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	t.Setenv(health.OpenAIDefaultAPIKeyEnv, "")
+
+	cases := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, body: `{"error": {"message": "bad key"}}`, wantErr: "non-200 status code: 401"},
+		{name: "server error", status: http.StatusInternalServerError, body: `oops`, wantErr: "non-200 status code: 500"},
+		{name: "no embeddings", status: http.StatusOK, body: `{"data": []}`, wantErr: "no embeddings"},
+		{name: "invalid body", status: http.StatusOK, body: `not json`, wantErr: "failed to NewDecoder.Decode"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeOpenAI{status: tc.status, body: tc.body}
+
+			emb, err := EmbedderOfType("openai", map[string]string{"baseURL": fake.start(t), "model": "embed-test"})
+			if err != nil {
+				t.Fatalf("failed to EmbedderOfType: %s", err)
+			}
+
+			_, err = emb.Generate(context.Background(), "hi")
+			if err == nil {
+				t.Fatalf("Generate succeeded, want error containing %q", tc.wantErr)
+			}
+
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %q, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
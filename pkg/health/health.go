@@ -0,0 +1,12 @@
+// Package health holds what services, embedders, and storage share for readiness checks, along with the
+// config handling shared by the plugins for the same APIs
+package health
+
+import "context"
+
+// Checker is implemented by services, embedders, and storage that can check that they are usable (e.g.
+// that their API is reachable and serves their model) without doing any real work. It is used for
+// readiness checks, in which plugins that don't implement it are reported as unchecked
+type Checker interface {
+	Check(ctx context.Context) error
+}
@@ -0,0 +1,90 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ollamaTagsResponse lists the models that have been pulled
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// openAIModelsResponse lists the models served by the API
+type openAIModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// CheckOllamaModel checks that the ollama API at baseURL is reachable and has pulled model
+func CheckOllamaModel(ctx context.Context, client *http.Client, baseURL, model string) error {
+	tags := &ollamaTagsResponse{}
+	if err := getJSON(ctx, client, baseURL+"/api/tags", nil, tags); err != nil {
+		return err
+	}
+
+	// models pulled without a tag are listed with the latest tag
+	for _, m := range tags.Models {
+		if m.Name == model || m.Name == model+":latest" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("model %s has not been pulled", model)
+}
+
+// CheckOpenAIModel checks that the OpenAI-compatible API at baseURL is reachable, accepts apiKey
+// (if set), and serves model
+func CheckOpenAIModel(ctx context.Context, client *http.Client, baseURL, apiKey, model string) error {
+	headers := map[string]string{}
+	if apiKey != "" {
+		headers["Authorization"] = "Bearer " + apiKey
+	}
+
+	models := &openAIModelsResponse{}
+	if err := getJSON(ctx, client, baseURL+"/models", headers, models); err != nil {
+		return err
+	}
+
+	for _, m := range models.Data {
+		if m.ID == model {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("model %s is not served", model)
+}
+
+// getJSON makes a GET request to url with the given headers, decoding the JSON response body into v
+func getJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to NewRequestWithContext: %w", err)
+	}
+
+	for k, val := range headers {
+		req.Header.Set(k, val)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to Do: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to NewDecoder.Decode: %w", err)
+	}
+
+	return nil
+}
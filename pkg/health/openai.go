@@ -0,0 +1,27 @@
+package health
+
+import (
+	"fmt"
+	"os"
+)
+
+// OpenAIDefaultAPIKeyEnv is the env var holding the API key of openai services and embedders,
+// unless their config names another with apiKeyEnv
+const OpenAIDefaultAPIKeyEnv = "OPENAI_API_KEY"
+
+// OpenAIAPIKey reads the API key of an openai service or embedder from the env var named by its apiKeyEnv
+// config key (OPENAI_API_KEY by default). A missing key is only an error if apiKeyEnv was set explicitly,
+// since local gateways often need none
+func OpenAIAPIKey(cfg map[string]string) (string, error) {
+	envVar, explicit := cfg["apiKeyEnv"]
+	if !explicit {
+		envVar = OpenAIDefaultAPIKeyEnv
+	}
+
+	apiKey := os.Getenv(envVar)
+	if apiKey == "" && explicit {
+		return "", fmt.Errorf("env var %s (from config key apiKeyEnv) is empty", envVar)
+	}
+
+	return apiKey, nil
+}
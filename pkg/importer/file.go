@@ -1,6 +1,7 @@
 package importer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -16,7 +17,7 @@ type fileImporter struct {
 	config map[string]string
 }
 
-func (f *fileImporter) Run(batch string, resChan chan Result) error {
+func (f *fileImporter) Run(ctx context.Context, batch string, resChan chan Result) error {
 	dir, exists := f.config["directory"]
 	if !exists {
 		return errors.New("file importer missing config key: directory")
@@ -30,6 +31,10 @@ func (f *fileImporter) Run(batch string, resChan chan Result) error {
 			return nil
 		}
 
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		if d.IsDir() {
 			return nil
 		}
@@ -52,7 +57,11 @@ func (f *fileImporter) Run(batch string, resChan chan Result) error {
 			Batch:  batch,
 		}
 
-		resChan <- r
+		select {
+		case resChan <- r:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 
 		count++
 
@@ -69,12 +78,16 @@ func (f *fileImporter) Run(batch string, resChan chan Result) error {
 }
 
 // ResolveRefs resolves the provided references to their contents
-func (f *fileImporter) ResolveRefs(refs storage.Result) (*Result, error) {
+func (f *fileImporter) ResolveRefs(ctx context.Context, refs storage.Result) (*Result, error) {
 	r := &Result{
 		Documents: make([]string, len(refs.Refs)),
 	}
 
 	for i, ref := range refs.Refs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		slog.Info("resolving document", "ref", ref, "cosine", refs.Cosines[i])
 
 		fileBytes, err := os.ReadFile(filepath.Clean(ref))
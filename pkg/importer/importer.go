@@ -1,11 +1,17 @@
 package importer
 
-import "github.com/cohix/ragoo/pkg/storage"
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cohix/ragoo/pkg/storage"
+)
 
 // Importer represents an importer for a given data source
 type Importer interface {
-	Run(string, chan Result) error
-	ResolveRefs(storage.Result) (*Result, error)
+	Run(context.Context, string, chan Result) error
+	ResolveRefs(context.Context, storage.Result) (*Result, error)
 }
 
 // Result is the result of an importer
@@ -16,12 +22,36 @@ type Result struct {
 	Batch     string   `json:"batch"`
 }
 
-// ImporterOfType provides an importer for the given type
-func ImporterOfType(imType string, config map[string]string) Importer {
-	switch imType {
-	case "file":
-		return &fileImporter{config}
+// Constructor creates an importer from its config
+type Constructor func(config map[string]string) (Importer, error)
+
+var (
+	registry = map[string]Constructor{
+		"file": func(config map[string]string) (Importer, error) {
+			return &fileImporter{config}, nil
+		},
+	}
+	registryLock = sync.RWMutex{} // protect access to the registry for concurrent access
+)
+
+// Register makes an importer type available for use in config, replacing any existing type with the same name
+func Register(imType string, constructor Constructor) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[imType] = constructor
+}
+
+// ImporterOfType provides an importer for the given type, or an error if
+// the type is unknown or the config is invalid
+func ImporterOfType(imType string, config map[string]string) (Importer, error) {
+	registryLock.RLock()
+	constructor, exists := registry[imType]
+	registryLock.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("importer of type %s not found", imType)
 	}
 
-	return nil
+	return constructor(config)
 }
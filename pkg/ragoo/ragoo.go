@@ -0,0 +1,199 @@
+// Package ragoo is the entry point used by the ragoo binary. Custom binaries can register their own
+// plugins (e.g. with tool.Register or service.Register) and then call Main to run ragoo with them
+package ragoo
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/runner"
+	"github.com/cohix/ragoo/pkg/server"
+	"github.com/cohix/ragoo/pkg/storage"
+)
+
+// Main runs ragoo with the config file given as the CLI argument, exiting the process on failure.
+// Flags (e.g. -addr :8080) override the config file's server section
+func Main() {
+	flags := flag.NewFlagSet("ragoo", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [flags] <config file path>\n", flags.Name())
+		flags.PrintDefaults()
+	}
+
+	overrides := config.Server{}
+	flags.StringVar(&overrides.Address, "addr", "", "address for the server to listen on (e.g. :4141)")
+	flags.StringVar(&overrides.TLSCertFile, "tls-cert", "", "TLS certificate file")
+	flags.StringVar(&overrides.TLSKeyFile, "tls-key", "", "TLS key file")
+	flags.StringVar(&overrides.ReadTimeout, "read-timeout", "", "timeout for reading requests (e.g. 30s)")
+	flags.StringVar(&overrides.WriteTimeout, "write-timeout", "", "timeout for writing responses (e.g. 5m)")
+	flags.StringVar(&overrides.IdleTimeout, "idle-timeout", "", "timeout for idle connections (e.g. 2m)")
+	flags.StringVar(&overrides.ShutdownTimeout, "shutdown-timeout", "", "time to wait for requests and importer batches when stopping (e.g. 30s)")
+	flags.Int64Var(&overrides.MaxBodyBytes, "max-body-bytes", 0, "maximum size of request bodies")
+	flags.StringVar(&overrides.BasePath, "base-path", "", "path prefix for all routes (e.g. /ragoo)")
+	flags.BoolVar(&overrides.EnableAdmin, "enable-admin", false, "add the unauthenticated /admin endpoints and /readyz error details")
+
+	// ExitOnError means that Parse exits rather than returning an error
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 1 {
+		slog.Error("missing argument: <config file path>")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if err := Run(flags.Arg(0), overrides); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// Run starts the importers and server defined in the given config file, blocking until the server fails
+// or the process receives SIGINT or SIGTERM, at which point it shuts down gracefully: in-flight requests
+// and importer batches are given the server's shutdown timeout to finish before storage is closed.
+// Any fields set in overrides replace those of the config's server section
+func Run(configFilePath string, overrides config.Server) error {
+	slog.Info("--- Starting Ragoo --- ")
+
+	config, err := config.ReadConfigFromFile(configFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to ReadConfigFromFile: %w", err)
+	}
+
+	applyServerOverrides(&config.Server, overrides)
+
+	rn, err := runner.New(config)
+	if err != nil {
+		return fmt.Errorf("failed to runner.New: %w", err)
+	}
+
+	// the server is created before the importers start so that its config is checked first
+	srv, err := server.New(config, rn)
+	if err != nil {
+		return fmt.Errorf("failed to server.New: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := startImporters(ctx, rn, config); err != nil {
+		return fmt.Errorf("failed to startImporters: %w", err)
+	}
+
+	srvErr := make(chan error, 1)
+	go func() {
+		srvErr <- srv.Start()
+	}()
+
+	var runErr error
+
+	select {
+	case err := <-srvErr:
+		if err != nil {
+			runErr = fmt.Errorf("failed to srv.Start: %w", err)
+		}
+	case <-ctx.Done():
+		slog.Info("shutting down", "timeout", srv.ShutdownTimeout())
+	}
+
+	// restore the default signal handling, so that a second signal kills the process
+	stop()
+
+	if err := shutdown(srv, rn); err != nil {
+		return errors.Join(runErr, err)
+	}
+
+	slog.Info("--- Ragoo stopped ---")
+
+	return runErr
+}
+
+func startImporters(ctx context.Context, rn *runner.Runner, config *config.Config) error {
+	for _, imp := range config.Importers {
+		slog.Info("starting importer", "name", imp.Name)
+
+		if err := rn.StartImporter(ctx, imp); err != nil {
+			return fmt.Errorf("failed to StartImporter %s: %w", imp.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// shutdown stops the server, then waits for the importers' batches, then closes storage. The server
+// and importers share the shutdown timeout, after which their work is cancelled and waited for. Storage
+// is closed once nothing is using it, and left for the process exit if handlers failed to return
+func shutdown(srv *server.Server, rn *runner.Runner) error {
+	ctx, cancel := context.WithTimeout(context.Background(), srv.ShutdownTimeout())
+	defer cancel()
+
+	var errs []error
+
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to srv.Shutdown: %w", err))
+	}
+
+	if err := rn.WaitImporters(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to WaitImporters: %w", err))
+	}
+
+	if errors.Is(errors.Join(errs...), server.ErrHandlersRunning) {
+		slog.Warn("not closing storage, since it may still be in use")
+		return errors.Join(errs...)
+	}
+
+	if err := storage.CloseAll(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to storage.CloseAll: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// applyServerOverrides replaces the fields of cfg with those set in overrides
+func applyServerOverrides(cfg *config.Server, overrides config.Server) {
+	if overrides.Address != "" {
+		cfg.Address = overrides.Address
+	}
+
+	if overrides.TLSCertFile != "" {
+		cfg.TLSCertFile = overrides.TLSCertFile
+	}
+
+	if overrides.TLSKeyFile != "" {
+		cfg.TLSKeyFile = overrides.TLSKeyFile
+	}
+
+	if overrides.ReadTimeout != "" {
+		cfg.ReadTimeout = overrides.ReadTimeout
+	}
+
+	if overrides.WriteTimeout != "" {
+		cfg.WriteTimeout = overrides.WriteTimeout
+	}
+
+	if overrides.IdleTimeout != "" {
+		cfg.IdleTimeout = overrides.IdleTimeout
+	}
+
+	if overrides.ShutdownTimeout != "" {
+		cfg.ShutdownTimeout = overrides.ShutdownTimeout
+	}
+
+	if overrides.MaxBodyBytes != 0 {
+		cfg.MaxBodyBytes = overrides.MaxBodyBytes
+	}
+
+	if overrides.BasePath != "" {
+		cfg.BasePath = overrides.BasePath
+	}
+
+	if overrides.EnableAdmin {
+		cfg.EnableAdmin = true
+	}
+}
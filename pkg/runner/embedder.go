@@ -1,28 +1,29 @@
 package runner
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/cohix/ragoo/pkg/config"
 	"github.com/cohix/ragoo/pkg/embedder"
 )
 
-func (r *Runner) runEmbedder(stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
+func (r *Runner) runEmbedder(ctx context.Context, stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
 	var mult *Multivar
 
-	emb := r.embedder(stp.Ref)
-	if emb == nil {
-		return nil, "", fmt.Errorf("embedder with ref %s not found", stp.Ref)
+	emb, err := r.embedder(stp.Ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load embedder: %w", err)
 	}
 
 	switch stp.Action {
 	case "generate":
-		input, err := resolveParam("input", stp.Params, vars, false)
+		input, err := resolveTextParam("input", stp.Params, vars)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'input' for embedder: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveTextParam 'input' for embedder: %w", err)
 		}
 
-		res, err := emb.Generate(input.String)
+		res, err := emb.Generate(ctx, input)
 		if err != nil {
 			return nil, "", fmt.Errorf("embedder with ref %s resulted in error: %w", stp.Ref, err)
 		}
@@ -40,12 +41,17 @@ func (r *Runner) runEmbedder(stp config.Step, vars map[string]Multivar) (*Multiv
 	return mult, key, nil
 }
 
-func (r *Runner) embedder(ref string) embedder.Embedder {
+func (r *Runner) embedder(ref string) (embedder.Embedder, error) {
 	for _, emb := range r.config.Embedders {
 		if emb.Name == ref {
-			return embedder.EmbedderOfType(emb.Type, emb.Config)
+			e, err := embedder.EmbedderOfType(emb.Type, emb.Config)
+			if err != nil {
+				return nil, fmt.Errorf("embedder with ref %s is invalid: %w", ref, err)
+			}
+
+			return e, nil
 		}
 	}
 
-	return nil
+	return nil, fmt.Errorf("embedder with ref %s not found", ref)
 }
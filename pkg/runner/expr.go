@@ -0,0 +1,471 @@
+package runner
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// evalWhen evaluates a step or stage's when expression against the vars, an empty expression is always true.
+//
+// Expressions compare var paths (see lookupPath), string, number, and bool literals, and len(path) using
+// == != < <= > >=, and combine them with && || ! and parentheses, e.g. len(refs.Refs) == 0 && !_input.String
+func evalWhen(when string, vars map[string]Multivar) (bool, error) {
+	if strings.TrimSpace(when) == "" {
+		return true, nil
+	}
+
+	expr, err := parseWhen(when)
+	if err != nil {
+		return false, fmt.Errorf("failed to parseWhen: %w", err)
+	}
+
+	val, err := expr.eval(vars)
+	if err != nil {
+		return false, fmt.Errorf("failed to eval %q: %w", when, err)
+	}
+
+	return truthy(val), nil
+}
+
+// parseWhen parses a when expression, caching the result since the same expressions are evaluated on every run
+func parseWhen(when string) (exprNode, error) {
+	if strings.TrimSpace(when) == "" {
+		return literalNode{val: true}, nil
+	}
+
+	if cached, ok := parsedWhen.Load(when); ok {
+		return cached.(exprNode), nil
+	}
+
+	expr, err := parseExpr(when)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parseExpr: %w", err)
+	}
+
+	parsedWhen.Store(when, expr)
+
+	return expr, nil
+}
+
+var parsedWhen = sync.Map{}
+
+// exprNode is a parsed piece of a when expression
+type exprNode interface {
+	eval(vars map[string]Multivar) (any, error)
+}
+
+type literalNode struct{ val any }
+
+type pathNode struct{ path string }
+
+type lenNode struct{ arg exprNode }
+
+type notNode struct{ arg exprNode }
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n literalNode) eval(map[string]Multivar) (any, error) { return n.val, nil }
+
+func (n pathNode) eval(vars map[string]Multivar) (any, error) { return lookupPath(vars, n.path) }
+
+func (n lenNode) eval(vars map[string]Multivar) (any, error) {
+	val, err := n.arg.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if val == nil {
+		return 0, nil
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+		return rv.Len(), nil
+	}
+
+	return nil, fmt.Errorf("len of %T is undefined", val)
+}
+
+func (n notNode) eval(vars map[string]Multivar) (any, error) {
+	val, err := n.arg.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return !truthy(val), nil
+}
+
+func (n binaryNode) eval(vars map[string]Multivar) (any, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || short circuit, so the right side may refer to things that only exist if the left is true
+	switch n.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+	}
+
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return truthy(right), nil
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	}
+
+	return compare(n.op, left, right)
+}
+
+// truthy reports whether val is set, i.e. is not nil or the zero value of its type
+func truthy(val any) bool {
+	if val == nil {
+		return false
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return rv.Len() > 0
+	}
+
+	return !rv.IsZero()
+}
+
+func equal(left, right any) bool {
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			return l == r
+		}
+	}
+
+	if left == nil || right == nil {
+		return !truthy(left) && !truthy(right)
+	}
+
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return l == r
+		}
+	}
+
+	if l, ok := left.(bool); ok {
+		if r, ok := right.(bool); ok {
+			return l == r
+		}
+	}
+
+	return reflect.DeepEqual(left, right)
+}
+
+func compare(op string, left, right any) (bool, error) {
+	var cmp int
+
+	l, lok := toFloat(left)
+	r, rok := toFloat(right)
+
+	if lok && rok {
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	} else {
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		if !lok || !rok {
+			return false, fmt.Errorf("cannot compare %T %s %T", left, op, right)
+		}
+
+		cmp = strings.Compare(ls, rs)
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+
+	return false, fmt.Errorf("unknown operator %s", op)
+}
+
+func toFloat(val any) (float64, bool) {
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+
+	return 0, false
+}
+
+// exprParser is a recursive descent parser over the tokens of an expression
+type exprParser struct {
+	toks []string
+	pos  int
+}
+
+func parseExpr(src string) (exprNode, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{toks: toks}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q in %q", p.toks[p.pos], src)
+	}
+
+	return node, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+
+	return ""
+}
+
+func (p *exprParser) next() string {
+	tok := p.peek()
+	p.pos++
+
+	return tok
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = binaryNode{op: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "&&" {
+		p.next()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = binaryNode{op: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peek() == "!" {
+		p.next()
+
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return notNode{arg: arg}, nil
+	}
+
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op := p.peek(); op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		return binaryNode{op: op, left: left, right: right}, nil
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	tok := p.next()
+
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+
+	case tok == "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+
+		return node, nil
+
+	case tok == "len" && p.peek() == "(":
+		p.next()
+
+		arg, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ) after len argument")
+		}
+
+		return lenNode{arg: arg}, nil
+
+	case tok == "true" || tok == "false":
+		return literalNode{val: tok == "true"}, nil
+
+	case tok == "nil":
+		return literalNode{val: nil}, nil
+
+	case tok[0] == '"' || tok[0] == '\'':
+		return literalNode{val: tok[1 : len(tok)-1]}, nil
+
+	case tok[0] == '-' || unicode.IsDigit(rune(tok[0])):
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", tok)
+		}
+
+		return literalNode{val: f}, nil
+
+	case isPathChar(rune(tok[0])):
+		return pathNode{path: strings.TrimPrefix(tok, "$")}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+// tokenize splits an expression into operators, parentheses, literals, and paths
+func tokenize(src string) ([]string, error) {
+	toks := []string{}
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != c {
+				end++
+			}
+
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated string in %q", src)
+			}
+
+			toks = append(toks, string(runes[i:end+1]))
+			i = end + 1
+
+		case c == '(' || c == ')':
+			toks = append(toks, string(c))
+			i++
+
+		case strings.ContainsRune("=!<>&|", c):
+			if i+1 < len(runes) && twoCharOps[string(runes[i:i+2])] {
+				toks = append(toks, string(runes[i:i+2]))
+				i += 2
+				continue
+			}
+
+			if c == '=' || c == '&' || c == '|' {
+				return nil, fmt.Errorf("unexpected %q in %q", c, src)
+			}
+
+			toks = append(toks, string(c))
+			i++
+
+		case isPathChar(c) || c == '-':
+			end := i + 1
+			for end < len(runes) && (isPathChar(runes[end]) || runes[end] == '.' || runes[end] == '[' || runes[end] == ']') {
+				end++
+			}
+
+			toks = append(toks, string(runes[i:end]))
+			i = end
+
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", c, src)
+		}
+	}
+
+	return toks, nil
+}
+
+var twoCharOps = map[string]bool{"==": true, "!=": true, "<=": true, ">=": true, "&&": true, "||": true}
+
+func isPathChar(c rune) bool {
+	return c == '_' || c == '$' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
@@ -0,0 +1,146 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/cohix/ragoo/pkg/storage"
+)
+
+func exprTestVars() map[string]Multivar {
+	return map[string]Multivar{
+		"refs":   {Storage: &storage.Result{Refs: []string{"a", "b"}, Cosines: []float32{0.9, 0.5}}},
+		"_input": {String: `{"question": "why", "tags": ["x", "y"], "n": 3}`},
+		"quoted": {String: `it"s && more`},
+		"empty":  {},
+		"bad":    {String: "not json"},
+	}
+}
+
+func TestEvalWhen(t *testing.T) {
+	cases := []struct {
+		name    string
+		when    string
+		want    bool
+		wantErr bool
+	}{
+		{name: "empty expression", when: "  ", want: true},
+		{name: "bool literal", when: "true", want: true},
+		{name: "path truthiness", when: "refs", want: true},
+		{name: "unset var is falsy", when: "missing", want: false},
+		{name: "empty var is falsy", when: "empty", want: false},
+
+		// precedence: ! binds tighter than &&, which binds tighter than ||
+		{name: "and before or", when: "true || false && false", want: true},
+		{name: "and before or, reversed", when: "false && false || true", want: true},
+		{name: "not before and", when: "!false && false", want: false},
+		{name: "double not", when: "!!refs", want: true},
+		{name: "parentheses", when: "(true || false) && false", want: false},
+		{name: "comparison before and", when: "len(refs.Refs) == 2 && refs.Refs[0] == 'a'", want: true},
+
+		// short circuiting: the right side would fail with an index out of range
+		{name: "and short circuits", when: "len(refs.Refs) > 5 && refs.Refs[5] == 'x'", want: false},
+		{name: "or short circuits", when: "len(refs.Refs) == 2 || refs.Refs[5] == 'x'", want: true},
+		{name: "and evaluates right side", when: "len(refs.Refs) == 2 && refs.Refs[5] == 'x'", wantErr: true},
+
+		// len
+		{name: "len of slice", when: "len(refs.Refs) == 2", want: true},
+		{name: "len of string", when: "len(_input.String) > 10", want: true},
+		{name: "len of unset var", when: "len(missing) == 0", want: true},
+		{name: "len of nil field", when: "len(empty.Storage) == 0", want: true},
+		{name: "len of json list", when: "len(_input.json.tags) == 2", want: true},
+		{name: "len of number", when: "len(refs.Cosines[0]) == 0", wantErr: true},
+		{name: "len missing paren", when: "len(refs.Refs == 2", wantErr: true},
+
+		// nil comparisons
+		{name: "unset var equals nil", when: "missing == nil", want: true},
+		{name: "nil equals unset var", when: "nil == missing", want: true},
+		{name: "empty string equals nil", when: "empty.String == nil", want: true},
+		{name: "nil pointer equals nil", when: "empty.Storage == nil", want: true},
+		{name: "set var is not nil", when: "refs != nil", want: true},
+		{name: "set slice is not nil", when: "refs.Refs == nil", want: false},
+
+		// quoted strings
+		{name: "double quoted", when: `refs.Refs[1] == "b"`, want: true},
+		{name: "single quoted", when: `refs.Refs[1] == 'b'`, want: true},
+		{name: "quotes and operators inside string", when: `quoted.String == 'it"s && more'`, want: true},
+		{name: "string inequality", when: `refs.Refs[0] != "b"`, want: true},
+		{name: "string ordering", when: `refs.Refs[0] < refs.Refs[1]`, want: true},
+		{name: "unterminated string", when: `refs.Refs[0] == "a`, wantErr: true},
+
+		// numbers
+		{name: "float comparison", when: "refs.Cosines[0] > 0.8", want: true},
+		{name: "negative number", when: "refs.Cosines[1] >= -1", want: true},
+		{name: "number equality across types", when: "len(refs.Refs) == 2.0", want: true},
+		{name: "incomparable types", when: "refs.Refs > 1", wantErr: true},
+
+		// index out of range
+		{name: "index out of range", when: "refs.Refs[2] == 'a'", wantErr: true},
+		{name: "index of non-list", when: "refs.Cosines[0][1] == 1", wantErr: true},
+
+		// json segments
+		{name: "json field", when: "_input.json.question == 'why'", want: true},
+		{name: "json number", when: "_input.json.n == 3", want: true},
+		{name: "json list index", when: "_input.json.tags[1] == 'y'", want: true},
+		{name: "json missing key", when: "_input.json.nope == nil", want: true},
+		{name: "json invalid text", when: "bad.json.x == 1", wantErr: true},
+
+		// syntax errors
+		{name: "missing operand", when: "refs ==", wantErr: true},
+		{name: "missing close paren", when: "(refs", wantErr: true},
+		{name: "single equals", when: "refs = nil", wantErr: true},
+		{name: "trailing tokens", when: "refs refs", wantErr: true},
+		{name: "invalid character", when: "refs.Refs[0] == #", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := evalWhen(tc.when, exprTestVars())
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("evalWhen(%q) = %v, want error", tc.when, got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("evalWhen(%q) returned error: %s", tc.when, err)
+			}
+
+			if got != tc.want {
+				t.Errorf("evalWhen(%q) = %v, want %v", tc.when, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		src  string
+		want []string
+	}{
+		{src: "a==b", want: []string{"a", "==", "b"}},
+		{src: "!a && (b || c)", want: []string{"!", "a", "&&", "(", "b", "||", "c", ")"}},
+		{src: "len($refs.Refs[0]) >= -1.5", want: []string{"len", "(", "$refs.Refs[0]", ")", ">=", "-1.5"}},
+		{src: `x == "a = b"`, want: []string{"x", "==", `"a = b"`}},
+		{src: "x != 'y'", want: []string{"x", "!=", "'y'"}},
+	}
+
+	for _, tc := range cases {
+		got, err := tokenize(tc.src)
+		if err != nil {
+			t.Fatalf("tokenize(%q) returned error: %s", tc.src, err)
+		}
+
+		if len(got) != len(tc.want) {
+			t.Fatalf("tokenize(%q) = %q, want %q", tc.src, got, tc.want)
+		}
+
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("tokenize(%q) = %q, want %q", tc.src, got, tc.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/storage"
+)
+
+const (
+	itemKey  = "_item"
+	indexKey = "_index"
+)
+
+// runForeach runs the step's nested steps once for each element of the list var given by the 'items'
+// param. Each iteration sees the workflow's vars plus the element (as _item, or the var named by the 'as'
+// param) and its _index, and its steps' results are visible only to that iteration. The var named by
+// 'collect' (default: the last nested step's var) is gathered from each iteration that produced it into
+// the result's List, in element order, and their text joined by 'separator' (default: a blank line) into its String.
+// Up to 'concurrency' (default 1) iterations run at once
+func (r *Runner) runForeach(ctx context.Context, stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
+	if len(stp.Steps) == 0 {
+		return nil, "", fmt.Errorf("foreach step contains no steps")
+	}
+
+	list, err := resolveParamOfKind("items", stp.Params, vars, kindList, false)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolveParamOfKind 'items' for foreach: %w", err)
+	}
+
+	items, err := listItems(list)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to listItems: %w", err)
+	}
+
+	as := itemKey
+	if name, exists := stp.Params["as"]; exists {
+		as = name
+	}
+
+	collect := stepVar(stp.Steps[len(stp.Steps)-1])
+	if name, exists := stp.Params["collect"]; exists {
+		collect = name
+	}
+
+	concurrency, err := foreachConcurrency(stp.Params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	separator := "\n\n"
+	if sep, exists := stp.Params["separator"]; exists {
+		separator = sep
+	}
+
+	// iterations run in any order, so none of them may stream the workflow's response
+	ctx = context.WithValue(ctx, tokenStreamKey{}, nil)
+
+	// the workflow's vars are snapshotted here, since the caller may write to them once this step
+	// returns, and each iteration copies the snapshot so that they don't see each other's results
+	base := make(map[string]Multivar, len(vars))
+	for k, v := range vars {
+		base[k] = v
+	}
+
+	results := make([]*Multivar, len(items))
+	errs := make([]error, len(items))
+
+	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, concurrency)
+
+	var interrupted error
+
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			interrupted = ctx.Err()
+		}
+
+		if interrupted != nil {
+			break
+		}
+
+		wg.Add(1)
+
+		go func(i int, item Multivar) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			iterVars := make(map[string]Multivar, len(base)+2)
+			for k, v := range base {
+				iterVars[k] = v
+			}
+
+			iterVars[as] = item
+			iterVars[indexKey] = Multivar{String: strconv.Itoa(i)}
+
+			stg := config.Stage{Name: fmt.Sprintf("foreach[%d]", i), Steps: stp.Steps}
+
+			if _, err := r.runStage(ctx, stg, iterVars); err != nil {
+				errs[i] = fmt.Errorf("item %d failed: %w", i, err)
+				return
+			}
+
+			// an iteration whose steps were skipped by their when expressions is left out of the results
+			if res, exists := iterVars[collect]; exists {
+				results[i] = &res
+			}
+		}(i, item)
+	}
+
+	// iterations already running are waited for even if interrupted, so that none outlive the step
+	wg.Wait()
+
+	if interrupted != nil {
+		return nil, "", fmt.Errorf("foreach interrupted: %w", interrupted)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, "", err
+	}
+
+	collected := []Multivar{}
+	texts := []string{}
+
+	for _, res := range results {
+		if res == nil {
+			continue
+		}
+
+		collected = append(collected, *res)
+		texts = append(texts, responseText(*res))
+	}
+
+	combined := strings.Join(texts, separator)
+
+	mult := &Multivar{List: collected, String: combined, Bytes: []byte(combined)}
+
+	key := "foreach"
+	if stp.Var != "" {
+		key = stp.Var
+	}
+
+	return mult, key, nil
+}
+
+// listItems returns the elements of a list var: a foreach result's List, an importer result's documents,
+// a storage result's refs (each with its own single-ref storage result, so it can be resolved), the
+// messages of a conversation, or a JSON list
+func listItems(mult *Multivar) ([]Multivar, error) {
+	switch {
+	case mult.List != nil:
+		return mult.List, nil
+
+	case mult.Importer != nil:
+		items := make([]Multivar, len(mult.Importer.Documents))
+		for i, doc := range mult.Importer.Documents {
+			items[i] = Multivar{String: doc, Bytes: []byte(doc)}
+		}
+
+		return items, nil
+
+	case mult.Storage != nil:
+		items := make([]Multivar, len(mult.Storage.Refs))
+		for i, ref := range mult.Storage.Refs {
+			res := &storage.Result{Refs: []string{ref}}
+			if i < len(mult.Storage.Cosines) {
+				res.Cosines = []float32{mult.Storage.Cosines[i]}
+			}
+
+			if i < len(mult.Storage.Chunks) {
+				res.Chunks = []string{mult.Storage.Chunks[i]}
+			}
+
+			items[i] = Multivar{String: ref, Bytes: []byte(ref), Storage: res}
+		}
+
+		return items, nil
+
+	case mult.Messages != nil:
+		items := make([]Multivar, len(mult.Messages))
+		for i, msg := range mult.Messages {
+			items[i] = Multivar{String: msg.Content, Bytes: []byte(msg.Content), Any: msg}
+		}
+
+		return items, nil
+
+	case mult.Any != nil:
+		list, ok := mult.Any.([]any)
+		if !ok {
+			return nil, fmt.Errorf("var of type %T is not a list", mult.Any)
+		}
+
+		return anyItems(list), nil
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(mult.String), "[") {
+		list := []any{}
+		if err := json.Unmarshal([]byte(mult.String), &list); err != nil {
+			return nil, fmt.Errorf("failed to json.Unmarshal list: %w", err)
+		}
+
+		return anyItems(list), nil
+	}
+
+	return nil, fmt.Errorf("var is not a list")
+}
+
+func anyItems(list []any) []Multivar {
+	items := make([]Multivar, len(list))
+	for i, el := range list {
+		if s, ok := el.(string); ok {
+			items[i] = Multivar{String: s, Bytes: []byte(s)}
+			continue
+		}
+
+		items[i] = Multivar{Any: el}
+	}
+
+	return items
+}
+
+// foreachConcurrency returns the foreach step's 'concurrency' param, or 1 if unset
+func foreachConcurrency(params map[string]string) (int, error) {
+	c, exists := params["concurrency"]
+	if !exists {
+		return 1, nil
+	}
+
+	concurrency, err := strconv.Atoi(c)
+	if err != nil || concurrency < 1 {
+		return 0, fmt.Errorf("foreach step has invalid concurrency %s", c)
+	}
+
+	return concurrency, nil
+}
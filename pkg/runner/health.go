@@ -0,0 +1,176 @@
+package runner
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/health"
+)
+
+// Statuses of a readiness check
+const (
+	CheckOK        = "ok"
+	CheckFailed    = "failed"
+	CheckUnchecked = "unchecked" // the plugin doesn't implement health.Checker
+)
+
+// how long readiness check results are reused, so that frequent probes don't call every backend each time
+const readyCacheTTL = 30 * time.Second
+
+// Check is the result of checking that one of the configured services, embedders, or storage is usable.
+// Plugins that are only used as fallbacks aren't critical, and don't fail readiness
+type Check struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
+
+// readyCache holds the results of the last readiness check
+type readyCache struct {
+	lock    sync.Mutex // held while checking, so that concurrent probes share one check
+	checks  []Check
+	ready   bool
+	checked time.Time
+}
+
+// CheckReady checks each of the configured services, embedders, and storage concurrently, returning
+// the checks in config order and whether all of the critical ones passed. Unchecked plugins don't fail
+// readiness. The results are reused for 30s
+func (r *Runner) CheckReady(ctx context.Context) ([]Check, bool) {
+	r.ready.lock.Lock()
+	defer r.ready.lock.Unlock()
+
+	if r.ready.checks == nil || time.Since(r.ready.checked) > readyCacheTTL {
+		r.ready.checks, r.ready.ready = r.checkReady(ctx)
+		r.ready.checked = time.Now()
+	}
+
+	return append([]Check{}, r.ready.checks...), r.ready.ready
+}
+
+func (r *Runner) checkReady(ctx context.Context) ([]Check, bool) {
+	fallbacks := r.fallbackOnlyRefs()
+
+	checks := []Check{}
+	plugins := []any{}
+
+	for _, srv := range r.config.Services {
+		s, err := r.service(srv.Name)
+		checks = append(checks, Check{Kind: "service", Name: srv.Name, Critical: !fallbacks["service/"+srv.Name]})
+		plugins = append(plugins, pluginOrErr(s, err))
+	}
+
+	for _, emb := range r.config.Embedders {
+		e, err := r.embedder(emb.Name)
+		checks = append(checks, Check{Kind: "embedder", Name: emb.Name, Critical: !fallbacks["embedder/"+emb.Name]})
+		plugins = append(plugins, pluginOrErr(e, err))
+	}
+
+	for _, str := range r.config.Storage {
+		s, err := r.storage(str.Name)
+		checks = append(checks, Check{Kind: "storage", Name: str.Name, Critical: !fallbacks["storage/"+str.Name]})
+		plugins = append(plugins, pluginOrErr(s, err))
+	}
+
+	wg := sync.WaitGroup{}
+
+	for i := range checks {
+		wg.Add(1)
+
+		go func(chk *Check, plugin any) {
+			defer wg.Done()
+
+			var err error
+
+			switch p := plugin.(type) {
+			case error:
+				err = p
+			case health.Checker:
+				err = p.Check(ctx)
+			default:
+				chk.Status = CheckUnchecked
+				return
+			}
+
+			if err != nil {
+				slog.Warn("readiness check failed", "kind", chk.Kind, "name", chk.Name, "critical", chk.Critical, "error", err.Error())
+
+				chk.Status = CheckFailed
+				chk.Error = err.Error()
+				return
+			}
+
+			chk.Status = CheckOK
+		}(&checks[i], plugins[i])
+	}
+
+	wg.Wait()
+
+	ready := true
+	for _, chk := range checks {
+		if chk.Status == CheckFailed && chk.Critical {
+			ready = false
+		}
+	}
+
+	return checks, ready
+}
+
+// pluginOrErr returns err if it is set, so that a plugin that can't be created fails its check
+func pluginOrErr(plugin any, err error) any {
+	if err != nil {
+		return err
+	}
+
+	return plugin
+}
+
+// fallbackOnlyRefs returns the refs (as type/name) that steps only use as fallbacks
+func (r *Runner) fallbackOnlyRefs() map[string]bool {
+	primary := map[string]bool{}
+	fallback := map[string]bool{}
+
+	var walk func(steps []config.Step)
+	walk = func(steps []config.Step) {
+		for _, stp := range steps {
+			primary[stp.Type+"/"+stp.Ref] = true
+
+			if stp.Fallback != "" {
+				fallback[stp.Type+"/"+stp.Fallback] = true
+			}
+
+			walk(stp.Steps)
+		}
+	}
+
+	for _, wrk := range r.config.Workflows {
+		for _, stg := range wrk.Stages {
+			walk(stg.Steps)
+		}
+	}
+
+	for _, imp := range r.config.Importers {
+		walk(imp.Steps)
+		walk([]config.Step{imp.Cleanup})
+	}
+
+	for _, rt := range r.config.Routes {
+		if rt.Session != nil {
+			primary["storage/"+rt.Session.Storage] = true
+			primary["service/"+rt.Session.Summarize] = true
+		}
+	}
+
+	for ref := range fallback {
+		if primary[ref] {
+			delete(fallback, ref)
+		}
+	}
+
+	return fallback
+}
@@ -1,6 +1,7 @@
 package runner
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
@@ -13,18 +14,120 @@ import (
 	"github.com/cohix/ragoo/pkg/importer"
 )
 
-// StartImporter starts the provided importer on a goroutine
-func (r *Runner) StartImporter(imp config.Importer) error {
-	im := importer.ImporterOfType(imp.Type, imp.Config)
-	if im == nil {
-		return fmt.Errorf("importer of type %s not found", imp.Type)
+// States of an importer
+const (
+	ImporterPending   = "pending" // no batch has been started yet
+	ImporterRunning   = "running"
+	ImporterSucceeded = "succeeded"
+	ImporterFailed    = "failed"
+)
+
+// ImporterStatus describes an importer's current or most recent batch. Chunks counts the chunks
+// processed so far, and FailedChunks those whose steps failed (which fails the batch once it finishes)
+type ImporterStatus struct {
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	State        string     `json:"state"`
+	Batch        string     `json:"batch,omitempty"`
+	Started      *time.Time `json:"started,omitempty"`
+	Finished     *time.Time `json:"finished,omitempty"`
+	Chunks       int        `json:"chunks"`
+	FailedChunks int        `json:"failedChunks"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// StartImporter starts the provided importer on a goroutine, running a batch every five minutes until
+// ctx is cancelled. A batch in progress when ctx is cancelled is allowed to finish (see WaitImporters)
+func (r *Runner) StartImporter(ctx context.Context, imp config.Importer) error {
+	im, err := importer.ImporterOfType(imp.Type, imp.Config)
+	if err != nil {
+		return fmt.Errorf("importer %s is invalid: %w", imp.Name, err)
+	}
+
+	r.importers.Add(1)
+
+	go func() {
+		defer r.importers.Done()
+
+		for {
+			err := r.runImporterBatch(ctx, imp, im)
+			if err != nil {
+				slog.Error(fmt.Errorf("failed to runImporterBatch %s: %w", imp.Name, err).Error())
+			}
+
+			r.updateImporterStatus(imp.Name, func(st *ImporterStatus) {
+				now := time.Now()
+				st.Finished = &now
+
+				if err != nil {
+					st.State = ImporterFailed
+					st.Error = err.Error()
+				} else {
+					st.State = ImporterSucceeded
+				}
+			})
+
+			if !sleepCtx(ctx, time.Minute*5) {
+				slog.Info("stopped importer", "name", imp.Name)
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// WaitImporters waits for the importers started by StartImporter (whose contexts should already be
+// cancelled) to finish their current batches. If ctx is done first, the batches are cancelled, which
+// interrupts them between storage operations, and then waited for
+func (r *Runner) WaitImporters(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.importers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		r.abortImporters()
+		<-done
+
+		return fmt.Errorf("importers cancelled mid-batch: %w", ctx.Err())
+	}
+}
+
+// runImporterBatch runs the importer once, runs the importer's steps on each chunk it produces, and then
+// runs its cleanup. If any chunk fails, the cleanup is skipped so that the previous batch's data is kept
+// in place of a partial import. The batch isn't cancelled along with ctx, only by abortImporters
+func (r *Runner) runImporterBatch(ctx context.Context, imp config.Importer, im importer.Importer) error {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	stopAbort := context.AfterFunc(r.abortCtx, cancel)
+	defer stopAbort()
+
+	batchID, err := batchID()
+	if err != nil {
+		return fmt.Errorf("failed to batchID: %w", err)
 	}
 
+	r.updateImporterStatus(imp.Name, func(st *ImporterStatus) {
+		now := time.Now()
+		*st = ImporterStatus{Name: imp.Name, Type: imp.Type, State: ImporterRunning, Batch: batchID, Started: &now}
+	})
+
 	resultChan := make(chan importer.Result, 1)
+	processed := make(chan struct{})
+
+	// only written by the goroutine below, and read once it has closed processed
+	failedChunks := 0
 
-	// first of two goroutines to catch any results generated by the importer
-	// and run the defined steps on each chunk
+	// catch the results generated by the importer and run the defined steps on each chunk
 	go func() {
+		defer close(processed)
+
 		for res := range resultChan {
 			for _, ch := range res.Chunks {
 				vars := map[string]Multivar{
@@ -33,89 +136,83 @@ func (r *Runner) StartImporter(imp config.Importer) error {
 					batchKey: {String: res.Batch},
 				}
 
+				failed := false
+
 				for _, stp := range imp.Steps {
-					switch stp.Type {
-					case "embedder":
-						mult, key, err := r.runEmbedder(stp, vars)
-						if err != nil {
-							slog.Error(fmt.Errorf("failed to runEmbedder: %w", err).Error())
-							return
-						}
+					mult, key, err := r.runStep(ctx, stp, vars)
+					if err != nil {
+						slog.Error(fmt.Errorf("failed to runStep for chunk of %s: %w", res.Ref, err).Error())
+						failed = true
+						break
+					}
 
+					if mult != nil {
 						vars[key] = *mult
+					}
+				}
 
-					case "storage":
-						mult, key, err := r.runStorage(stp, vars)
-						if err != nil {
-							slog.Error(fmt.Errorf("failed to runStorage: %w", err).Error())
-							return
-						}
+				if failed {
+					failedChunks++
+				}
 
-						vars[key] = *mult
+				r.updateImporterStatus(imp.Name, func(st *ImporterStatus) {
+					st.Chunks++
+					if failed {
+						st.FailedChunks++
 					}
-				}
+				})
 			}
 		}
 	}()
 
-	// second of two goroutines to run the importer and its defined
-	// cleanup steps on a regular schedule
-	go func() {
-		for {
-			batchID, err := batchID()
-			if err != nil {
-				slog.Error(fmt.Errorf("failed to batchID: %w", err).Error())
-				time.Sleep(time.Minute * 5)
-				continue
-			}
+	err = im.Run(ctx, batchID, resultChan)
+	close(resultChan)
+	<-processed
 
-			if err := im.Run(batchID, resultChan); err != nil {
-				slog.Error(fmt.Errorf("failed to Run importer %s: %w", imp.Name, err).Error())
-				time.Sleep(time.Minute * 5)
-				continue
-			} else {
-				slog.Info("ran importer successfully", "name", imp.Name)
-			}
+	if err != nil {
+		return fmt.Errorf("failed to Run: %w", err)
+	}
 
-			vars := map[string]Multivar{
-				batchKey: {String: batchID},
-			}
+	if failedChunks > 0 {
+		return fmt.Errorf("%d chunks failed, skipping cleanup to keep the previous batch", failedChunks)
+	}
 
-			switch imp.Cleanup.Type {
-			case "storage":
-				_, _, err := r.runStorage(imp.Cleanup, vars)
-				if err != nil {
-					slog.Error(fmt.Errorf("failed to runStorage: %w", err).Error())
-				} else {
-					slog.Info("ran importer cleanup successfully", "name", imp.Name)
-				}
-			default:
-				slog.Error(fmt.Errorf("encountered cleanup with unsupported type: %s", imp.Cleanup.Type).Error())
-			}
+	slog.Info("ran importer successfully", "name", imp.Name, "batch", batchID)
+
+	vars := map[string]Multivar{
+		batchKey: {String: batchID},
+	}
 
-			time.Sleep(time.Minute * 5)
+	switch imp.Cleanup.Type {
+	case "storage":
+		if _, _, err := r.runStep(ctx, imp.Cleanup, vars); err != nil {
+			return fmt.Errorf("failed to runStorage for cleanup: %w", err)
 		}
-	}()
+
+		slog.Info("ran importer cleanup successfully", "name", imp.Name)
+	default:
+		return fmt.Errorf("encountered cleanup with unsupported type: %s", imp.Cleanup.Type)
+	}
 
 	return nil
 }
 
-func (r *Runner) runImporter(stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
+func (r *Runner) runImporter(ctx context.Context, stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
 	var mult *Multivar
 
-	imp := r.importer(stp.Ref)
-	if imp == nil {
-		return nil, "", fmt.Errorf("importer with ref %s not found", stp.Ref)
+	imp, err := r.importer(stp.Ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load importer: %w", err)
 	}
 
 	switch stp.Action {
 	case "resolve.refs":
-		refs, err := resolveParam("refs", stp.Params, vars, false)
+		refs, err := resolveParamOfKind("refs", stp.Params, vars, kindRefs, false)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'refs' for importer: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveParamOfKind 'refs' for importer: %w", err)
 		}
 
-		res, err := imp.ResolveRefs(*refs.Storage)
+		res, err := imp.ResolveRefs(ctx, *refs.Storage)
 		if err != nil {
 			return nil, "", fmt.Errorf("importer with ref %s resulted in error: %w", stp.Ref, err)
 		}
@@ -128,7 +225,8 @@ func (r *Runner) runImporter(stp config.Step, vars map[string]Multivar) (*Multiv
 
 		combined := strings.Join(res.Documents, seperator)
 
-		mult = &Multivar{Importer: res, String: combined, Bytes: []byte(combined)}
+		// the refs are kept alongside the documents so that each can be attributed to its source
+		mult = &Multivar{Importer: res, Storage: refs.Storage, String: combined, Bytes: []byte(combined)}
 	default:
 		return nil, "", fmt.Errorf("importer with ref %s called with invalid action %s", stp.Ref, stp.Action)
 	}
@@ -141,14 +239,65 @@ func (r *Runner) runImporter(stp config.Step, vars map[string]Multivar) (*Multiv
 	return mult, key, nil
 }
 
-func (r *Runner) importer(ref string) importer.Importer {
+func (r *Runner) importer(ref string) (importer.Importer, error) {
 	for _, imp := range r.config.Importers {
 		if imp.Name == ref {
-			return importer.ImporterOfType(imp.Type, imp.Config)
+			im, err := importer.ImporterOfType(imp.Type, imp.Config)
+			if err != nil {
+				return nil, fmt.Errorf("importer with ref %s is invalid: %w", ref, err)
+			}
+
+			return im, nil
 		}
 	}
 
-	return nil
+	return nil, fmt.Errorf("importer with ref %s not found", ref)
+}
+
+// ImporterStatuses returns the status of each configured importer, in config order
+func (r *Runner) ImporterStatuses() []ImporterStatus {
+	r.statusLock.Lock()
+	defer r.statusLock.Unlock()
+
+	statuses := []ImporterStatus{}
+
+	for _, imp := range r.config.Importers {
+		if st, exists := r.statuses[imp.Name]; exists {
+			statuses = append(statuses, *st)
+			continue
+		}
+
+		statuses = append(statuses, ImporterStatus{Name: imp.Name, Type: imp.Type, State: ImporterPending})
+	}
+
+	return statuses
+}
+
+// updateImporterStatus calls update with the named importer's status while holding the lock
+func (r *Runner) updateImporterStatus(name string, update func(st *ImporterStatus)) {
+	r.statusLock.Lock()
+	defer r.statusLock.Unlock()
+
+	st, exists := r.statuses[name]
+	if !exists {
+		st = &ImporterStatus{Name: name}
+		r.statuses[name] = st
+	}
+
+	update(st)
+}
+
+// sleepCtx sleeps for the given duration, returning false early if ctx is cancelled
+func sleepCtx(ctx context.Context, dur time.Duration) bool {
+	timer := time.NewTimer(dur)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 func batchID() (string, error) {
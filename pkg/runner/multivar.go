@@ -2,6 +2,7 @@ package runner
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/cohix/ragoo/pkg/embedder"
@@ -13,14 +14,18 @@ import (
 
 // Multivar represents one of several types of variables
 type Multivar struct {
-	String    string           `json:"string,omitempty"`
-	Bytes     []byte           `json:"bytes,omitempty"`
-	Any       any              `json:"obj,omitempty"`
-	Embedding *embedder.Result `json:"embedding,omitempty"`
-	Tool      *tool.Result     `json:"tool,omitempty"`
-	Service   *service.Result  `json:"service,omitempty"`
-	Storage   *storage.Result  `json:"storage,omitempty"`
-	Importer  *importer.Result `json:"importer,omitempty"`
+	String    string              `json:"string,omitempty"`
+	Bytes     []byte              `json:"bytes,omitempty"`
+	Any       any                 `json:"obj,omitempty"`
+	Embedding *embedder.Result    `json:"embedding,omitempty"`
+	Tool      *tool.Result        `json:"tool,omitempty"`
+	Service   *service.Result     `json:"service,omitempty"`
+	Messages  []service.Message   `json:"messages,omitempty"`
+	Vars      map[string]Multivar `json:"vars,omitempty"`
+	List      []Multivar          `json:"list,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Storage   *storage.Result     `json:"storage,omitempty"`
+	Importer  *importer.Result    `json:"importer,omitempty"`
 }
 
 func resolveParam(key string, params map[string]string, vars map[string]Multivar, optional bool) (*Multivar, error) {
@@ -39,35 +44,99 @@ func resolveParam(key string, params map[string]string, vars map[string]Multivar
 	return multi, nil
 }
 
-// varSubst returns val if it is not a "variable" (i.e. starts with $), otherwise returns
-// the value of the variable in vars with the matching name (sans $)
+// varPathPattern matches a var reference, optionally with a path into the var (e.g. $refs or $refs.Refs[0])
+var varPathPattern = regexp.MustCompile(`^\$[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*|\[[0-9]+\])*$`)
+
+// varSubst returns val if it is not a "variable" (i.e. $name), otherwise returns the value of the
+// variable in vars with the matching name, or of the field at the path following it (see lookupPath)
 func varSubst(val string, vars map[string]Multivar) (*Multivar, error) {
-	if !strings.HasPrefix(val, "$") || strings.Count(val, "$") > 1 {
+	if !varPathPattern.MatchString(val) {
 		return &Multivar{String: val}, nil
 	}
 
-	varVal, exists := vars[strings.TrimPrefix(val, "$")]
+	path := strings.TrimPrefix(val, "$")
+	name := path[:strings.IndexAny(path+".", ".[")]
+
+	varVal, exists := vars[name]
 	if !exists {
-		return nil, fmt.Errorf("workflow vars missing value for key %s", val)
+		return nil, fmt.Errorf("workflow vars missing value for key $%s", name)
 	}
 
-	return &varVal, nil
-}
+	if name == path {
+		return &varVal, nil
+	}
+
+	resolved, err := lookupPath(vars, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookupPath: %w", err)
+	}
 
-func promptSubst(prompt string, vars map[string]Multivar) (string, error) {
-	for k, mv := range vars {
-		key := fmt.Sprintf("$%s", k)
+	if resolved == nil {
+		return nil, fmt.Errorf("%s has no value", val)
+	}
 
-		val := mv.String
-		if val == "" {
-			val = string(mv.Bytes)
-			if val == "" {
-				continue
-			}
+	mult := toMultivar(resolved)
+
+	return &mult, nil
+}
+
+// toMultivar wraps a value found by lookupPath in the Multivar field matching its type
+func toMultivar(val any) Multivar {
+	switch v := val.(type) {
+	case Multivar:
+		return v
+	case string:
+		return Multivar{String: v, Bytes: []byte(v)}
+	case []byte:
+		return Multivar{String: string(v), Bytes: v}
+	case embedder.Result:
+		return Multivar{Embedding: &v}
+	case storage.Result:
+		return Multivar{Storage: &v}
+	case importer.Result:
+		return Multivar{Importer: &v}
+	case service.Result:
+		return Multivar{Service: &v}
+	case tool.Result:
+		return Multivar{Tool: &v, String: v.Output}
+	case service.Message:
+		return Multivar{String: v.Content, Bytes: []byte(v.Content), Any: v}
+	case []service.Message:
+		return Multivar{Messages: v}
+	case []Multivar:
+		return Multivar{List: v}
+	case map[string]Multivar:
+		return Multivar{Vars: v}
+	case []string:
+		list := make([]Multivar, len(v))
+		for i, s := range v {
+			list[i] = Multivar{String: s, Bytes: []byte(s)}
 		}
 
-		prompt = strings.Replace(prompt, key, val, -1)
+		return Multivar{List: list}
+	case bool, int, int64, float32, float64:
+		s := fmt.Sprint(v)
+		return Multivar{String: s, Bytes: []byte(s), Any: v}
+	}
+
+	// e.g. objects and lists parsed from JSON
+	return Multivar{Any: val}
+}
+
+// responseText returns the text of a workflow's response var
+func responseText(resp any) string {
+	mv, ok := resp.(Multivar)
+	if !ok {
+		return fmt.Sprint(resp)
+	}
+
+	if mv.Service != nil {
+		return mv.Service.Completion
+	}
+
+	if mv.String != "" {
+		return mv.String
 	}
 
-	return prompt, nil
+	return string(mv.Bytes)
 }
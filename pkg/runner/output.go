@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"fmt"
+)
+
+// Output shapes the result according to a route's output mapping, in which each value that refers to a
+// var or a path into one (e.g. $refs.Refs) is replaced with what it refers to, and other values are used
+// as is. Vars are given as their text where they have any. Without a mapping, the output is the
+// response's text as 'response'
+func (res *Result) Output(mapping map[string]string) (map[string]any, error) {
+	if len(mapping) == 0 {
+		return map[string]any{"response": responseText(res.Response)}, nil
+	}
+
+	out := make(map[string]any, len(mapping))
+
+	for key, val := range mapping {
+		if !varPathPattern.MatchString(val) {
+			out[key] = val
+			continue
+		}
+
+		resolved, err := lookupPath(res.Vars, val[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookupPath for output %s: %w", key, err)
+		}
+
+		if mv, ok := resolved.(Multivar); ok {
+			if text := responseText(mv); text != "" {
+				resolved = text
+			}
+		}
+
+		out[key] = resolved
+	}
+
+	return out, nil
+}
@@ -0,0 +1,201 @@
+package runner
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cohix/ragoo/pkg/config"
+)
+
+// varKind is a kind of value a var can hold, used to check that steps are given the vars they expect
+type varKind string
+
+const (
+	kindText      varKind = "text"
+	kindEmbedding varKind = "embedding"
+	kindRefs      varKind = "storage refs"
+	kindDocs      varKind = "documents"
+	kindMessages  varKind = "messages"
+	kindList      varKind = "list"
+)
+
+// kindHints describe where each kind of var usually comes from, for error messages
+var kindHints = map[varKind]string{
+	kindEmbedding: "e.g. the var of an embedder generate step",
+	kindRefs:      "e.g. the var of a storage lookup.cosine step",
+	kindList:      "e.g. refs, documents, messages, a foreach result, or a JSON list",
+}
+
+// paramKinds is the kind of var expected by each param of each step type and action (as type/action).
+// Params not listed here accept a var of any kind
+var paramKinds = map[string]map[string]varKind{
+	"embedder/generate":        {"input": kindText},
+	"storage/lookup.cosine":    {"embedding": kindEmbedding, "collection": kindText, "limit": kindText, "threshold": kindText},
+	"storage/insert.embedding": {"embedding": kindEmbedding, "collection": kindText, "ref": kindText, "chunk": kindText, "batch": kindText},
+	"storage/cleanup":          {"collection": kindText, "batch": kindText},
+	"importer/resolve.refs":    {"refs": kindRefs},
+	"service/chat":             {"messages": kindMessages},
+	"foreach/":                 {"items": kindList},
+}
+
+// resolveParamOfKind resolves a param like resolveParam, then checks that its value is of the given kind,
+// so that e.g. a storage lookup given a completion instead of an embedding fails with a clear error
+func resolveParamOfKind(key string, params map[string]string, vars map[string]Multivar, kind varKind, optional bool) (*Multivar, error) {
+	mult, err := resolveParam(key, params, vars, optional)
+	if err != nil || mult == nil {
+		return mult, err
+	}
+
+	if !slices.Contains(mult.kinds(), kind) {
+		return nil, kindError(key, params[key], kind, mult.kinds())
+	}
+
+	return mult, nil
+}
+
+// resolveTextParam resolves a param that must be text, returning the text
+func resolveTextParam(key string, params map[string]string, vars map[string]Multivar) (string, error) {
+	mult, err := resolveParamOfKind(key, params, vars, kindText, false)
+	if err != nil {
+		return "", err
+	}
+
+	return responseText(*mult), nil
+}
+
+// kinds returns the kinds of value the var holds (some vars, like resolved documents, are of several kinds)
+func (mv Multivar) kinds() []varKind {
+	kinds := []varKind{}
+
+	if mv.Embedding != nil {
+		kinds = append(kinds, kindEmbedding)
+	}
+
+	if mv.Storage != nil {
+		kinds = append(kinds, kindRefs)
+	}
+
+	if mv.Importer != nil {
+		kinds = append(kinds, kindDocs)
+	}
+
+	if mv.Messages != nil {
+		kinds = append(kinds, kindMessages)
+	}
+
+	if _, err := listItems(&mv); err == nil {
+		kinds = append(kinds, kindList)
+	}
+
+	// anything that isn't structured (including an empty value) can be used as text
+	if responseText(mv) != "" || len(kinds) == 0 {
+		kinds = append(kinds, kindText)
+	}
+
+	// conversations are also accepted as JSON, e.g. from a request body, but only if they parse as one
+	if mv.Messages == nil && (mv.Any != nil || responseText(mv) != "") {
+		if _, err := messagesFromVar(&mv); err == nil {
+			kinds = append(kinds, kindMessages)
+		}
+	}
+
+	return kinds
+}
+
+func kindError(key, val string, want varKind, have []varKind) error {
+	hint := ""
+	if h, exists := kindHints[want]; exists {
+		hint = fmt.Sprintf(" (%s)", h)
+	}
+
+	names := make([]string, len(have))
+	for i, k := range have {
+		names[i] = string(k)
+	}
+
+	if len(names) == 0 {
+		names = []string{"nothing"}
+	}
+
+	return fmt.Errorf("param '%s' must be %s%s, but %s holds %s", key, withArticle(want), hint, val, strings.Join(names, ", "))
+}
+
+func withArticle(kind varKind) string {
+	switch kind {
+	case kindEmbedding:
+		return "an embedding"
+	case kindText, kindDocs, kindMessages, kindRefs:
+		return string(kind)
+	}
+
+	return "a " + string(kind)
+}
+
+// producedKinds returns the kinds of var a step is known to produce, or nil if it can't be known
+// before the step runs (e.g. the response of a sub-workflow)
+func producedKinds(stp config.Step) []varKind {
+	switch stp.Type + "/" + stp.Action {
+	case "embedder/generate":
+		return []varKind{kindEmbedding}
+	case "storage/lookup.cosine":
+		return []varKind{kindRefs, kindList}
+	case "importer/resolve.refs":
+		return []varKind{kindDocs, kindRefs, kindList, kindText}
+	case "service/completion":
+		return []varKind{kindText}
+	case "service/chat":
+		return []varKind{kindText, kindMessages}
+	case "foreach/":
+		return []varKind{kindList, kindText}
+	}
+
+	return nil
+}
+
+// validateParamKinds checks that each step param which refers to a var produced by an earlier step
+// of the workflow is given a var of the kind it expects, so that a mis-wired workflow fails at startup.
+// produced holds the kinds of the vars produced so far and is updated with the steps' own vars
+func validateParamKinds(steps []config.Step, produced map[string][]varKind) error {
+	for _, stp := range steps {
+		for key, want := range paramKinds[stp.Type+"/"+stp.Action] {
+			val, exists := stp.Params[key]
+			if !exists || !varPathPattern.MatchString(val) || strings.ContainsAny(val, ".[") {
+				continue
+			}
+
+			have, known := produced[strings.TrimPrefix(val, "$")]
+			if known && !slices.Contains(have, want) {
+				return fmt.Errorf("step %s %s is invalid: %w", stp.Type, stp.Ref, kindError(key, val, want, have))
+			}
+		}
+
+		if stp.Type == "foreach" {
+			// the nested steps see the vars produced so far, but their own vars don't outlive the loop
+			inner := map[string][]varKind{}
+			for k, v := range produced {
+				inner[k] = v
+			}
+
+			as := itemKey
+			if name, exists := stp.Params["as"]; exists {
+				as = name
+			}
+
+			delete(inner, as)
+
+			if err := validateParamKinds(stp.Steps, inner); err != nil {
+				return fmt.Errorf("foreach step is invalid: %w", err)
+			}
+		}
+
+		// a step that may fail and continue produces a var holding only its error
+		if kinds := producedKinds(stp); kinds != nil && stp.OnError != onErrorContinue {
+			produced[stepVar(stp)] = kinds
+		} else {
+			delete(produced, stepVar(stp))
+		}
+	}
+
+	return nil
+}
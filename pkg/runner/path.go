@@ -0,0 +1,202 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is a single field name or index in a var path
+type pathSegment struct {
+	field string
+	index int
+	isIdx bool
+}
+
+// lookupPath resolves a path such as refs.Storage.Refs[0] against the vars, where the first
+// segment names a var and each later segment is a struct field, map key, or slice index, or
+// json, which parses the text of the value so far as JSON (e.g. _input.json.question).
+// A missing var or nil value along the way resolves to nil rather than an error
+func lookupPath(vars map[string]Multivar, path string) (any, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parsePath %s: %w", path, err)
+	}
+
+	if segs[0].isIdx {
+		return nil, fmt.Errorf("path %s must begin with a var name", path)
+	}
+
+	root, exists := vars[segs[0].field]
+	if !exists {
+		return nil, nil
+	}
+
+	val := reflect.ValueOf(root)
+
+	for _, seg := range segs[1:] {
+		for val.Kind() == reflect.Pointer || val.Kind() == reflect.Interface {
+			if val.IsNil() {
+				return nil, nil
+			}
+
+			val = val.Elem()
+		}
+
+		// a json segment parses the text of a var (e.g. a request body) so that the path can continue into it
+		if seg.field == "json" {
+			if text, ok := jsonText(val); ok {
+				var parsed any
+				if err := json.Unmarshal([]byte(text), &parsed); err != nil {
+					return nil, fmt.Errorf("failed to json.Unmarshal value in path %s: %w", path, err)
+				}
+
+				if parsed == nil {
+					return nil, nil
+				}
+
+				val = reflect.ValueOf(parsed)
+				continue
+			}
+		}
+
+		if seg.isIdx {
+			switch val.Kind() {
+			case reflect.Slice, reflect.Array, reflect.String:
+				if seg.index < 0 || seg.index >= val.Len() {
+					return nil, fmt.Errorf("index %d out of range in path %s (length %d)", seg.index, path, val.Len())
+				}
+
+				val = val.Index(seg.index)
+			default:
+				return nil, fmt.Errorf("cannot index %s in path %s", val.Kind(), path)
+			}
+
+			continue
+		}
+
+		switch val.Kind() {
+		case reflect.Struct:
+			field := structField(val, seg.field)
+			if !field.IsValid() {
+				return nil, fmt.Errorf("field %s not found in path %s (have %s)", seg.field, path, fieldNames(val.Type()))
+			}
+
+			val = field
+		case reflect.Map:
+			if val.Type().Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("cannot look up %s in non-string keyed map in path %s", seg.field, path)
+			}
+
+			val = val.MapIndex(reflect.ValueOf(seg.field).Convert(val.Type().Key()))
+			if !val.IsValid() {
+				return nil, nil
+			}
+		default:
+			return nil, fmt.Errorf("cannot look up field %s of %s in path %s", seg.field, val.Kind(), path)
+		}
+	}
+
+	for val.Kind() == reflect.Pointer || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return nil, nil
+		}
+
+		val = val.Elem()
+	}
+
+	return val.Interface(), nil
+}
+
+// jsonText returns the text that a json path segment parses, if val has any
+func jsonText(val reflect.Value) (string, bool) {
+	if !val.CanInterface() {
+		return "", false
+	}
+
+	switch v := val.Interface().(type) {
+	case Multivar:
+		if len(v.Bytes) > 0 {
+			return string(v.Bytes), true
+		}
+
+		return v.String, v.String != ""
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+
+	return "", false
+}
+
+// parsePath splits a path like a.B[0].C into its segments
+func parsePath(path string) ([]pathSegment, error) {
+	segs := []pathSegment{}
+
+	for _, part := range strings.Split(path, ".") {
+		name, rest, _ := strings.Cut(part, "[")
+		if name == "" && len(segs) == 0 {
+			return nil, fmt.Errorf("empty segment")
+		}
+
+		if name != "" {
+			segs = append(segs, pathSegment{field: name})
+		}
+
+		for rest != "" {
+			idx, after, found := strings.Cut(rest, "]")
+			if !found {
+				return nil, fmt.Errorf("unclosed index")
+			}
+
+			i, err := strconv.Atoi(idx)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %s", idx)
+			}
+
+			segs = append(segs, pathSegment{index: i, isIdx: true})
+
+			rest = strings.TrimPrefix(after, "[")
+			if after != "" && !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("unexpected %s after index", after)
+			}
+		}
+	}
+
+	return segs, nil
+}
+
+// structField finds the named field of val (ignoring case). If val has no such field, the fields of its
+// set pointer-to-struct fields are searched too, so that e.g. refs.Refs finds the Refs of a Multivar's Storage
+func structField(val reflect.Value, name string) reflect.Value {
+	match := func(n string) bool { return strings.EqualFold(n, name) }
+
+	if field := val.FieldByNameFunc(match); field.IsValid() {
+		return field
+	}
+
+	for i := 0; i < val.NumField(); i++ {
+		inner := val.Field(i)
+		if inner.Kind() != reflect.Pointer || inner.IsNil() || inner.Elem().Kind() != reflect.Struct {
+			continue
+		}
+
+		if field := inner.Elem().FieldByNameFunc(match); field.IsValid() {
+			return field
+		}
+	}
+
+	return reflect.Value{}
+}
+
+func fieldNames(t reflect.Type) string {
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		names = append(names, t.Field(i).Name)
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cohix/ragoo/pkg/storage"
+)
+
+func TestLookupPath(t *testing.T) {
+	vars := map[string]Multivar{
+		"refs":   {Storage: &storage.Result{Refs: []string{"a", "b"}, Chunks: []string{"first", "second"}}},
+		"_input": {String: `{"question": "why", "tags": ["x", "y"], "nested": {"deep": [1, 2]}}`},
+		"body":   {Bytes: []byte(`{"answer": 42}`)},
+		"obj":    {Any: map[string]any{"key": "val"}},
+		"empty":  {},
+		"bad":    {String: "not json"},
+	}
+
+	cases := []struct {
+		name    string
+		path    string
+		want    any
+		wantErr bool
+	}{
+		{name: "whole var", path: "empty", want: Multivar{}},
+		{name: "unset var", path: "missing", want: nil},
+		{name: "path into unset var", path: "missing.Storage.Refs", want: nil},
+		{name: "field", path: "_input.String", want: vars["_input"].String},
+		{name: "field ignoring case", path: "_input.string", want: vars["_input"].String},
+		{name: "field of pointer field", path: "refs.Storage.Refs", want: []string{"a", "b"}},
+		{name: "field found through pointer field", path: "refs.Refs", want: []string{"a", "b"}},
+		{name: "index", path: "refs.Refs[1]", want: "b"},
+		{name: "index of string", path: "refs.Chunks[0][1]", want: uint8('i')},
+		{name: "nil pointer field", path: "empty.Storage", want: nil},
+		{name: "path through nil pointer", path: "empty.Storage.Refs", want: nil},
+		{name: "map key", path: "obj.Any.key", want: "val"},
+		{name: "missing map key", path: "obj.Any.nope", want: nil},
+		{name: "unknown field", path: "refs.Nope", wantErr: true},
+		{name: "index out of range", path: "refs.Refs[2]", wantErr: true},
+		{name: "negative index", path: "refs.Refs[-1]", wantErr: true},
+		{name: "index of struct", path: "refs[0]", wantErr: true},
+		{name: "field of string", path: "_input.String.Length", wantErr: true},
+
+		{name: "json field", path: "_input.json.question", want: "why"},
+		{name: "json index", path: "_input.json.tags[0]", want: "x"},
+		{name: "json nested", path: "_input.json.nested.deep[1]", want: float64(2)},
+		{name: "json of bytes", path: "body.json.answer", want: float64(42)},
+		{name: "json of field", path: "_input.String.json.question", want: "why"},
+		{name: "json missing key", path: "_input.json.nope", want: nil},
+		{name: "json invalid", path: "bad.json.x", wantErr: true},
+
+		{name: "leading index", path: "[0]", wantErr: true},
+		{name: "unclosed index", path: "refs.Refs[0", wantErr: true},
+		{name: "invalid index", path: "refs.Refs[x]", wantErr: true},
+		{name: "text after index", path: "refs.Refs[0]x", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := lookupPath(vars, tc.path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("lookupPath(%q) = %v, want error", tc.path, got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("lookupPath(%q) returned error: %s", tc.path, err)
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("lookupPath(%q) = %#v, want %#v", tc.path, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cohix/ragoo/pkg/config"
+)
+
+// runRespond sets the workflow's _response to the step's 'response' param (rendered like a prompt).
+// In a sequential stage the workflow ends as soon as it runs, skipping the stage's later steps and any
+// later stages; in a parallel stage the workflow ends once the stage completes. Combined with a when
+// expression this allows e.g. a canned answer to be given when no docs are found
+func (r *Runner) runRespond(ctx context.Context, stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
+	text, _, err := promptParam("response", stp.Params, vars, false)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to promptParam 'response' for respond: %w", err)
+	}
+
+	if onToken, ok := ctx.Value(tokenStreamKey{}).(func(string) error); ok && onToken != nil && text != "" {
+		if err := onToken(text); err != nil {
+			return nil, "", fmt.Errorf("failed to onToken: %w", err)
+		}
+	}
+
+	return &Multivar{String: text, Bytes: []byte(text)}, responseKey, nil
+}
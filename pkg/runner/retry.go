@@ -0,0 +1,183 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/cohix/ragoo/pkg/config"
+)
+
+const (
+	onErrorFail     = "fail"
+	onErrorContinue = "continue"
+	onErrorFallback = "fallback"
+
+	defaultRetryBackoff = time.Second
+)
+
+// runStep runs a single step, retrying it if it fails. If it still fails, its onError policy decides
+// what happens: 'fail' (the default) fails the workflow, 'fallback' runs the step again with its fallback
+// ref (failing the workflow if that fails too, and otherwise setting the result's Error to the original
+// error), and 'continue' sets the step's var to a Multivar holding only the error (which later steps can
+// check with e.g. when: summary.Error != "")
+func (r *Runner) runStep(ctx context.Context, stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
+	// tokens already streamed to the client can't be taken back, so a step that fails
+	// part way through streaming its response is not retried or run with its fallback
+	streamed := &atomic.Bool{}
+	if onToken, ok := ctx.Value(tokenStreamKey{}).(func(string) error); ok && onToken != nil {
+		ctx = WithTokenStream(ctx, func(token string) error {
+			streamed.Store(true)
+			return onToken(token)
+		})
+	}
+
+	mult, key, err := r.runStepWithRetry(ctx, stp, vars, streamed)
+	if err == nil {
+		return mult, key, nil
+	}
+
+	if stp.OnError == onErrorFallback && ctx.Err() == nil && !streamed.Load() {
+		slog.Warn("workflow step failed, trying fallback", "type", stp.Type, "ref", stp.Ref, "fallback", stp.Fallback, "error", err.Error())
+
+		fallback := stp
+		fallback.Ref = stp.Fallback
+
+		mult, key, fallbackErr := r.runStepWithRetry(ctx, fallback, vars, streamed)
+		if fallbackErr == nil {
+			// record the primary's error so that the workflow can tell that it failed over
+			if mult == nil {
+				mult, key = &Multivar{}, stepVar(stp)
+			}
+
+			mult.Error = err.Error()
+
+			return mult, key, nil
+		}
+
+		err = errors.Join(err, fmt.Errorf("fallback with ref %s failed: %w", stp.Fallback, fallbackErr))
+	}
+
+	if stp.OnError == onErrorContinue {
+		slog.Warn("workflow step failed, continuing", "type", stp.Type, "ref", stp.Ref, "var", stepVar(stp), "error", err.Error())
+
+		return &Multivar{Error: err.Error()}, stepVar(stp), nil
+	}
+
+	return nil, "", err
+}
+
+// runStepWithRetry runs the step up to its retry policy's number of attempts, backing off between them
+func (r *Runner) runStepWithRetry(ctx context.Context, stp config.Step, vars map[string]Multivar, streamed *atomic.Bool) (*Multivar, string, error) {
+	attempts, backoff, err := retryPolicy(stp.Retry)
+	if err != nil {
+		return nil, "", fmt.Errorf("step with ref %s has invalid retry: %w", stp.Ref, err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		mult, key, err := r.runStepOnce(ctx, stp, vars)
+		if err == nil {
+			return mult, key, nil
+		}
+
+		if attempt >= attempts || ctx.Err() != nil || streamed.Load() {
+			return nil, "", err
+		}
+
+		slog.Warn("workflow step failed, retrying", "type", stp.Type, "ref", stp.Ref, "attempt", attempt, "backoff", backoff.String(), "error", err.Error())
+
+		if !sleepCtx(ctx, backoff) {
+			return nil, "", fmt.Errorf("retry interrupted: %w", errors.Join(err, ctx.Err()))
+		}
+
+		backoff *= 2
+	}
+}
+
+// retryPolicy returns the total number of attempts and the initial backoff for a step
+func retryPolicy(retry *config.Retry) (int, time.Duration, error) {
+	if retry == nil {
+		return 1, 0, nil
+	}
+
+	if retry.Attempts < 0 {
+		return 0, 0, fmt.Errorf("attempts must not be negative")
+	}
+
+	attempts := max(retry.Attempts, 1)
+
+	backoff := defaultRetryBackoff
+	if retry.Backoff != "" {
+		dur, err := time.ParseDuration(retry.Backoff)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to ParseDuration for backoff: %w", err)
+		}
+
+		backoff = dur
+	}
+
+	return attempts, backoff, nil
+}
+
+// validateErrorPolicy checks a step's retry, onError, and fallback settings
+func validateErrorPolicy(stp config.Step) error {
+	if _, _, err := retryPolicy(stp.Retry); err != nil {
+		return fmt.Errorf("invalid retry: %w", err)
+	}
+
+	switch stp.OnError {
+	case "", onErrorFail, onErrorContinue:
+		if stp.Fallback != "" {
+			return fmt.Errorf("fallback ref %s is set but onError is not %s", stp.Fallback, onErrorFallback)
+		}
+	case onErrorFallback:
+		if stp.Fallback == "" {
+			return fmt.Errorf("onError is %s but no fallback ref is set", onErrorFallback)
+		}
+	default:
+		return fmt.Errorf("invalid onError %s (must be one of %s, %s, %s)", stp.OnError, onErrorFail, onErrorContinue, onErrorFallback)
+	}
+
+	return nil
+}
+
+// validateStepRef checks that ref names a valid plugin or workflow of the given step type
+func (r *Runner) validateStepRef(stpType, ref string) error {
+	switch stpType {
+	case "service":
+		_, err := r.service(ref)
+		return err
+	case "embedder":
+		_, err := r.embedder(ref)
+		return err
+	case "importer":
+		_, err := r.importer(ref)
+		return err
+	case "storage":
+		_, err := r.storage(ref)
+		return err
+	case "workflow":
+		if r.workflowFromConfig(ref) == nil {
+			return fmt.Errorf("workflow with ref %s not found", ref)
+		}
+	default:
+		return fmt.Errorf("steps of type %s do not support fallback refs", stpType)
+	}
+
+	return nil
+}
+
+// stepVar returns the name of the var a step's result is stored in
+func stepVar(stp config.Step) string {
+	switch {
+	case stp.Type == "respond":
+		return responseKey
+	case stp.Var != "":
+		return stp.Var
+	}
+
+	return stp.Type
+}
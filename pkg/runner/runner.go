@@ -1,10 +1,25 @@
 package runner
 
-import "github.com/cohix/ragoo/pkg/config"
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cohix/ragoo/pkg/config"
+)
 
 // Runner is an orchestrator for workflows and importers
 type Runner struct {
 	config *config.Config
+
+	importers      sync.WaitGroup  // tracks the importers started by StartImporter
+	abortCtx       context.Context // cancelled to interrupt importers' batches
+	abortImporters context.CancelFunc
+
+	statuses   map[string]*ImporterStatus // the latest batch of each importer, by name
+	statusLock sync.Mutex                 // protect statuses as importers run concurrently
+
+	ready readyCache
 }
 
 // Result is the result of a workflow
@@ -13,10 +28,146 @@ type Result struct {
 	Vars     map[string]Multivar `json:"vars"`
 }
 
+// New returns a new runner, validating the configured plugins so that
+// misconfiguration is caught at startup rather than on first use
 func New(config *config.Config) (*Runner, error) {
 	r := &Runner{
-		config: config,
+		config:   config,
+		statuses: map[string]*ImporterStatus{},
+	}
+
+	r.abortCtx, r.abortImporters = context.WithCancel(context.Background())
+
+	if err := r.validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate: %w", err)
 	}
 
 	return r, nil
 }
+
+func (r *Runner) validate() error {
+	for _, emb := range r.config.Embedders {
+		if _, err := r.embedder(emb.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, srv := range r.config.Services {
+		if _, err := r.service(srv.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, str := range r.config.Storage {
+		if _, err := r.storage(str.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, imp := range r.config.Importers {
+		if _, err := r.importer(imp.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range r.config.Tools {
+		if _, _, err := r.tool(t.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, wrk := range r.config.Workflows {
+		if wrk.Timeout != "" {
+			if _, err := parseTimeout(wrk.Timeout); err != nil {
+				return fmt.Errorf("workflow %s has invalid timeout: %w", wrk.Name, err)
+			}
+		}
+
+		for _, stg := range wrk.Stages {
+			if _, err := parseWhen(stg.When); err != nil {
+				return fmt.Errorf("workflow %s stage %s has invalid when expression: %w", wrk.Name, stg.Name, err)
+			}
+
+			if err := r.validateSteps(stg.Steps); err != nil {
+				return fmt.Errorf("workflow %s stage %s is invalid: %w", wrk.Name, stg.Name, err)
+			}
+		}
+
+		produced := map[string][]varKind{}
+		for _, stg := range wrk.Stages {
+			if err := validateParamKinds(stg.Steps, produced); err != nil {
+				return fmt.Errorf("workflow %s stage %s is invalid: %w", wrk.Name, stg.Name, err)
+			}
+		}
+	}
+
+	for _, rt := range r.config.Routes {
+		if rt.Session == nil {
+			continue
+		}
+
+		if _, err := r.sessionStore(rt.Session.Storage); err != nil {
+			return fmt.Errorf("route %s has session with invalid storage: %w", rt.Path, err)
+		}
+
+		if rt.Session.Summarize != "" {
+			if _, err := r.service(rt.Session.Summarize); err != nil {
+				return fmt.Errorf("route %s has session with invalid summarize service: %w", rt.Path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSteps checks the when expressions, timeouts, error handling (including fallback refs), tools, params,
+// and prompts of the steps and any nested steps
+func (r *Runner) validateSteps(steps []config.Step) error {
+	for _, stp := range steps {
+		if _, err := parseWhen(stp.When); err != nil {
+			return fmt.Errorf("step %s %s has invalid when expression: %w", stp.Type, stp.Ref, err)
+		}
+
+		if stp.Timeout != "" {
+			if _, err := parseTimeout(stp.Timeout); err != nil {
+				return fmt.Errorf("step %s %s has invalid timeout: %w", stp.Type, stp.Ref, err)
+			}
+		}
+
+		if err := validateErrorPolicy(stp); err != nil {
+			return fmt.Errorf("step %s %s has invalid error handling: %w", stp.Type, stp.Ref, err)
+		}
+
+		if stp.Fallback != "" {
+			if err := r.validateStepRef(stp.Type, stp.Fallback); err != nil {
+				return fmt.Errorf("step %s %s has invalid fallback: %w", stp.Type, stp.Ref, err)
+			}
+		}
+
+		if stp.Type == "service" {
+			if _, _, err := r.stepTools(stp.Params); err != nil {
+				return fmt.Errorf("step %s %s has invalid tools: %w", stp.Type, stp.Ref, err)
+			}
+
+			if _, err := maxToolIterations(stp.Params); err != nil {
+				return fmt.Errorf("step %s %s has invalid params: %w", stp.Type, stp.Ref, err)
+			}
+		}
+
+		if stp.Type == "foreach" {
+			if _, err := foreachConcurrency(stp.Params); err != nil {
+				return fmt.Errorf("step %s %s has invalid params: %w", stp.Type, stp.Ref, err)
+			}
+		}
+
+		if err := validatePrompts(stp); err != nil {
+			return fmt.Errorf("step %s %s has invalid prompt: %w", stp.Type, stp.Ref, err)
+		}
+
+		if err := r.validateSteps(stp.Steps); err != nil {
+			return fmt.Errorf("foreach step is invalid: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -1,42 +1,120 @@
 package runner
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/cohix/ragoo/pkg/config"
 	"github.com/cohix/ragoo/pkg/service"
 )
 
-func (r *Runner) runService(stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
+func (r *Runner) runService(ctx context.Context, stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
 	var mult *Multivar
 
-	srv := r.service(stp.Ref)
-	if srv == nil {
-		return nil, "", fmt.Errorf("service with ref %s not found", stp.Ref)
+	srv, err := r.service(stp.Ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load service: %w", err)
 	}
 
+	req := service.Request{}
+
 	switch stp.Action {
 	case "completion":
-		prompt, err := resolveParam("prompt", stp.Params, vars, false)
+		prompt, _, err := promptParam("prompt", stp.Params, vars, false)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'prompt' for service: %w", err)
+			return nil, "", fmt.Errorf("failed to promptParam 'prompt' for service: %w", err)
 		}
 
-		augmented, err := promptSubst(prompt.String, vars)
+		req.Prompt = prompt
+	case "chat":
+		history, err := resolveParamOfKind("messages", stp.Params, vars, kindMessages, false)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to promptSubst: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveParamOfKind 'messages' for service: %w", err)
 		}
 
-		res, err := srv.Completion(augmented)
+		msgs, err := messagesFromVar(history)
 		if err != nil {
-			return nil, "", fmt.Errorf("embedder with ref %s resulted in error: %w", stp.Ref, err)
+			return nil, "", fmt.Errorf("failed to messagesFromVar: %w", err)
 		}
 
-		mult = &Multivar{Service: res}
+		// an optional prompt is appended to the conversation as a user message,
+		// which allows e.g. RAG context to be injected into each turn
+		prompt, exists, err := promptParam("prompt", stp.Params, vars, true)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to promptParam 'prompt' for service: %w", err)
+		}
+
+		if exists {
+			msgs = append(msgs, service.Message{Role: service.RoleUser, Content: prompt})
+		}
+
+		if len(msgs) == 0 {
+			return nil, "", fmt.Errorf("service with ref %s called with no messages", stp.Ref)
+		}
+
+		req.Messages = msgs
 	default:
 		return nil, "", fmt.Errorf("service with ref %s called with invalid action %s", stp.Ref, stp.Action)
 	}
 
+	opts, err := serviceOptions(stp.Params, vars)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to serviceOptions: %w", err)
+	}
+
+	req.Options = opts
+
+	tools, specs, err := r.stepTools(stp.Params)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to stepTools: %w", err)
+	}
+
+	// only the step producing the workflow's response is streamed
+	var onToken func(string) error
+	if stp.Var == responseKey {
+		onToken, _ = ctx.Value(tokenStreamKey{}).(func(string) error)
+	}
+
+	var res *service.Result
+	msgs := req.Messages
+
+	if len(tools) > 0 {
+		maxIter, err := maxToolIterations(stp.Params)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to maxToolIterations: %w", err)
+		}
+
+		req.Tools = specs
+
+		res, msgs, err = r.completeWithTools(ctx, srv, req, tools, maxIter)
+		if err != nil {
+			return nil, "", fmt.Errorf("service with ref %s resulted in error: %w", stp.Ref, err)
+		}
+
+		// the tool calling loop isn't streamed, so the final answer is sent all at once
+		if onToken != nil && res.Completion != "" {
+			if err := onToken(res.Completion); err != nil {
+				return nil, "", fmt.Errorf("failed to onToken: %w", err)
+			}
+		}
+	} else {
+		req.OnToken = onToken
+
+		res, err = srv.Completion(ctx, req)
+		if err != nil {
+			return nil, "", fmt.Errorf("service with ref %s resulted in error: %w", stp.Ref, err)
+		}
+	}
+
+	mult = &Multivar{Service: res}
+
+	if stp.Action == "chat" {
+		// the var carries the whole conversation so that it can be continued by later steps
+		mult.Messages = append(msgs, service.Message{Role: service.RoleAssistant, Content: res.Completion})
+	}
+
 	key := "service"
 	if stp.Var != "" {
 		key = stp.Var
@@ -45,12 +123,103 @@ func (r *Runner) runService(stp config.Step, vars map[string]Multivar) (*Multiva
 	return mult, key, nil
 }
 
-func (r *Runner) service(ref string) service.Service {
+// serviceParams are the step params consumed by the runner rather than passed to the service
+var serviceParams = map[string]bool{
+	"prompt":            true,
+	"promptFile":        true,
+	"messages":          true,
+	"tools":             true,
+	"maxToolIterations": true,
+}
+
+// serviceOptions resolves every step param not in serviceParams into
+// per-request overrides of the service's config (e.g. temperature, system)
+func serviceOptions(params map[string]string, vars map[string]Multivar) (map[string]string, error) {
+	opts := map[string]string{}
+
+	for k := range params {
+		if serviceParams[k] {
+			continue
+		}
+
+		val, err := resolveParam(k, params, vars, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolveParam '%s' for service: %w", k, err)
+		}
+
+		opts[k] = val.String
+	}
+
+	return opts, nil
+}
+
+func (r *Runner) service(ref string) (service.Service, error) {
 	for _, srv := range r.config.Services {
 		if srv.Name == ref {
-			return service.ServiceOfType(srv.Type, srv.Config)
+			s, err := service.ServiceOfType(srv.Type, srv.Config)
+			if err != nil {
+				return nil, fmt.Errorf("service with ref %s is invalid: %w", ref, err)
+			}
+
+			return s, nil
+		}
+	}
+
+	return nil, fmt.Errorf("service with ref %s not found", ref)
+}
+
+// messagesFromVar returns the conversation held by mv, either as the messages of a previous chat
+// step or as JSON (a list of messages, or an object with a 'messages' list) e.g. from a request body
+func messagesFromVar(mv *Multivar) ([]service.Message, error) {
+	if mv.Messages != nil {
+		return append([]service.Message{}, mv.Messages...), nil
+	}
+
+	raw := mv.Bytes
+	if len(raw) == 0 {
+		raw = []byte(mv.String)
+	}
+
+	// e.g. a list of messages found by a path into a JSON request body
+	if len(raw) == 0 && mv.Any != nil {
+		anyBytes, err := json.Marshal(mv.Any)
+		if err != nil {
+			return nil, fmt.Errorf("failed to json.Marshal messages: %w", err)
+		}
+
+		raw = anyBytes
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return []service.Message{}, nil
+	}
+
+	msgs := []service.Message{}
+
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &msgs); err != nil {
+			return nil, fmt.Errorf("failed to json.Unmarshal messages list: %w", err)
+		}
+	} else {
+		obj := struct {
+			Messages []service.Message `json:"messages"`
+		}{}
+
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("failed to json.Unmarshal messages object: %w", err)
+		}
+
+		msgs = obj.Messages
+	}
+
+	for i, m := range msgs {
+		switch m.Role {
+		case service.RoleSystem, service.RoleUser, service.RoleAssistant:
+		default:
+			return nil, fmt.Errorf("message %d has invalid role %s", i, m.Role)
 		}
 	}
 
-	return nil
+	return msgs, nil
 }
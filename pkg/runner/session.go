@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/service"
+	"github.com/cohix/ragoo/pkg/storage"
+)
+
+const defaultSessionTurns = 10
+
+const summaryPrompt = `Summarize the following conversation between a user and an assistant in a short paragraph,
+keeping any facts, names, and decisions that may be needed to continue it.
+----
+%s%s`
+
+// RunWorkflowInSession runs the named workflow as the next turn of a persisted conversation. The session's
+// history is provided to the workflow as the _history var (a list of messages usable by a chat step), and
+// the workflow's input and response are recorded as a new turn once it completes
+func (r *Runner) RunWorkflowInSession(ctx context.Context, sess config.Session, id string, ref string, params map[string]string) (*Result, error) {
+	str, err := r.sessionStore(sess.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session storage: %w", err)
+	}
+
+	history, err := r.sessionHistory(ctx, str, sess, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sessionHistory: %w", err)
+	}
+
+	res, err := r.runWorkflow(ctx, ref, params, map[string]Multivar{historyKey: {Messages: history}})
+	if err != nil {
+		return nil, err
+	}
+
+	turn := storage.Turn{
+		Input:    params[inputKey],
+		Response: responseText(res.Response),
+		Created:  time.Now(),
+	}
+
+	if sess.Refs != "" {
+		if refs, exists := res.Vars[sess.Refs]; exists && refs.Storage != nil {
+			turn.Refs = refs.Storage.Refs
+		}
+	}
+
+	if err := str.AppendTurn(ctx, id, turn); err != nil {
+		return nil, fmt.Errorf("failed to AppendTurn: %w", err)
+	}
+
+	return res, nil
+}
+
+// sessionHistory loads the session's recent turns as messages, preceded by a summary of any older
+// turns if the session is configured to summarize
+func (r *Runner) sessionHistory(ctx context.Context, str storage.SessionStore, sess config.Session, id string) ([]service.Message, error) {
+	limit := sess.Turns
+	if limit <= 0 {
+		limit = defaultSessionTurns
+	}
+
+	turns, err := str.LoadTurns(ctx, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to LoadTurns: %w", err)
+	}
+
+	msgs := []service.Message{}
+
+	// the turns before the first one loaded have fallen out of the window
+	if sess.Summarize != "" && len(turns) > 0 && turns[0].Seq > 1 {
+		summary, err := r.sessionSummary(ctx, str, sess.Summarize, id, turns[0].Seq-1, turns[len(turns)-1].Seq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sessionSummary: %w", err)
+		}
+
+		msgs = append(msgs, service.Message{Role: service.RoleSystem, Content: "Summary of the earlier conversation: " + summary})
+	}
+
+	for _, t := range turns {
+		msgs = append(msgs,
+			service.Message{Role: service.RoleUser, Content: t.Input},
+			service.Message{Role: service.RoleAssistant, Content: t.Response},
+		)
+	}
+
+	return msgs, nil
+}
+
+// sessionSummary returns a summary of the session's first 'older' turns (of 'latest' in total). The summary
+// is saved with the session, so only the turns that have fallen out of the window since it was last saved
+// are summarized, by folding them into the saved summary
+func (r *Runner) sessionSummary(ctx context.Context, str storage.SessionStore, ref string, id string, older, latest int) (string, error) {
+	saved, err := str.LoadSummary(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to LoadSummary: %w", err)
+	}
+
+	if saved == nil {
+		saved = &storage.Summary{}
+	}
+
+	if saved.Turns >= older {
+		return saved.Text, nil
+	}
+
+	// the turns after the summary are the most recent ones, so enough are loaded to reach back to it
+	recent, err := str.LoadTurns(ctx, id, latest-saved.Turns)
+	if err != nil {
+		return "", fmt.Errorf("failed to LoadTurns: %w", err)
+	}
+
+	fold := []storage.Turn{}
+	for _, t := range recent {
+		if t.Seq > saved.Turns && t.Seq <= older {
+			fold = append(fold, t)
+		}
+	}
+
+	text, err := r.summarizeTurns(ctx, ref, saved.Text, fold)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarizeTurns: %w", err)
+	}
+
+	summary := storage.Summary{Text: text, Turns: older, Updated: time.Now()}
+	if err := str.SaveSummary(ctx, id, summary); err != nil {
+		return "", fmt.Errorf("failed to SaveSummary: %w", err)
+	}
+
+	return text, nil
+}
+
+// summarizeTurns summarizes the turns, continuing from the previous summary (if any) of the turns before them
+func (r *Runner) summarizeTurns(ctx context.Context, ref string, previous string, turns []storage.Turn) (string, error) {
+	srv, err := r.service(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to load service: %w", err)
+	}
+
+	earlier := ""
+	if previous != "" {
+		earlier = fmt.Sprintf("Summary of the conversation before this point: %s\n\n", previous)
+	}
+
+	transcript := strings.Builder{}
+	for _, t := range turns {
+		transcript.WriteString(fmt.Sprintf("user: %s\nassistant: %s\n", t.Input, t.Response))
+	}
+
+	res, err := srv.Completion(ctx, service.Request{Prompt: fmt.Sprintf(summaryPrompt, earlier, transcript.String())})
+	if err != nil {
+		return "", fmt.Errorf("service with ref %s resulted in error: %w", ref, err)
+	}
+
+	return res.Completion, nil
+}
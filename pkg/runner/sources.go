@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// citationPattern matches citations such as [1] or [1, 3] in a response
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Source is a document that was retrieved for a workflow, numbered as it is by the docs prompt helper
+type Source struct {
+	Number int     `json:"number"`
+	Ref    string  `json:"ref"`
+	Cosine float32 `json:"cosine"`
+	Chunk  string  `json:"chunk,omitempty"`
+	Cited  bool    `json:"cited"`
+}
+
+// Sources returns the sources held by the var (or path into a var) with the given name, which must hold
+// storage refs (e.g. the var of a lookup.cosine or resolve.refs step). Sources whose numbers the
+// response cites (e.g. "... as described in [2]") are marked as Cited
+func (res *Result) Sources(name string) ([]Source, error) {
+	resolved, err := lookupPath(res.Vars, strings.TrimPrefix(name, "$"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookupPath: %w", err)
+	}
+
+	if resolved == nil {
+		return []Source{}, nil
+	}
+
+	mv := toMultivar(resolved)
+	if mv.Storage == nil {
+		return nil, fmt.Errorf("var %s holds %v rather than storage refs", name, mv.kinds())
+	}
+
+	cited := citations(responseText(res.Response))
+
+	sources := make([]Source, len(mv.Storage.Refs))
+	for i, ref := range mv.Storage.Refs {
+		sources[i] = Source{Number: i + 1, Ref: ref, Cited: cited[i+1]}
+
+		if i < len(mv.Storage.Cosines) {
+			sources[i].Cosine = mv.Storage.Cosines[i]
+		}
+
+		if i < len(mv.Storage.Chunks) {
+			sources[i].Chunk = mv.Storage.Chunks[i]
+		}
+	}
+
+	return sources, nil
+}
+
+// citations returns the numbers cited in the text
+func citations(text string) map[int]bool {
+	cited := map[int]bool{}
+
+	for _, match := range citationPattern.FindAllStringSubmatch(text, -1) {
+		for _, num := range strings.Split(match[1], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(num)); err == nil {
+				cited[n] = true
+			}
+		}
+	}
+
+	return cited
+}
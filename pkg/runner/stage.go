@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/cohix/ragoo/pkg/config"
+)
+
+// stepResult is the outcome of a single step run as part of a parallel stage
+type stepResult struct {
+	mult *Multivar
+	key  string
+	err  error
+}
+
+// runStage runs the stage's steps whose when expressions are met, adding their results to vars.
+// It returns true if a respond step ran, meaning the workflow should end. A respond step in a sequential
+// stage returns immediately, so the stage's later steps don't run
+func (r *Runner) runStage(ctx context.Context, stg config.Stage, vars map[string]Multivar) (bool, error) {
+	steps := []config.Step{}
+
+	for i, stp := range stg.Steps {
+		run, err := evalWhen(stp.When, vars)
+		if err != nil {
+			return false, fmt.Errorf("failed to evalWhen for step %d (%s %s): %w", i, stp.Type, stp.Ref, err)
+		}
+
+		if !run {
+			slog.Debug("workflow step condition not met, skipping", "stage", stg.Name, "step", i, "when", stp.When)
+			continue
+		}
+
+		// sequential steps' conditions are evaluated as they are reached, so may depend on earlier steps
+		if !stg.Parallel {
+			mult, key, err := r.runStep(ctx, stp, vars)
+			if err != nil {
+				return false, fmt.Errorf("failed to runStep: %w", err)
+			}
+
+			if mult != nil {
+				vars[key] = *mult
+			}
+
+			if stp.Type == "respond" {
+				return true, nil
+			}
+
+			continue
+		}
+
+		steps = append(steps, stp)
+	}
+
+	if !stg.Parallel {
+		return false, nil
+	}
+
+	if err := r.runStepsParallel(ctx, steps, vars); err != nil {
+		return false, err
+	}
+
+	for _, stp := range steps {
+		if stp.Type == "respond" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// runStepsParallel runs all of the steps concurrently. Each step sees the vars as they were before the
+// stage began, and their results are merged into vars (in step order) only once all have completed.
+// If any steps fail, their errors are returned together and no results are merged
+func (r *Runner) runStepsParallel(ctx context.Context, steps []config.Step, vars map[string]Multivar) error {
+	results := make([]stepResult, len(steps))
+
+	wg := sync.WaitGroup{}
+
+	// vars is only read while the steps are running, so it can be shared between them
+	for i, stp := range steps {
+		wg.Add(1)
+
+		go func(i int, stp config.Step) {
+			defer wg.Done()
+
+			mult, key, err := r.runStep(ctx, stp, vars)
+			results[i] = stepResult{mult, key, err}
+		}(i, stp)
+	}
+
+	wg.Wait()
+
+	errs := []error{}
+	for i, res := range results {
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("step %d (%s %s) failed: %w", i, steps[i].Type, steps[i].Ref, res.err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	merged := map[string]bool{}
+	for _, res := range results {
+		if res.mult == nil {
+			continue
+		}
+
+		if merged[res.key] {
+			slog.Warn("parallel steps produced the same var, later step wins", "var", res.key)
+		}
+
+		vars[res.key] = *res.mult
+		merged[res.key] = true
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package runner
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
@@ -8,96 +9,100 @@ import (
 	"github.com/cohix/ragoo/pkg/storage"
 )
 
-func (r *Runner) runStorage(stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
+func (r *Runner) runStorage(ctx context.Context, stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
 	var mult *Multivar
 
-	str := r.storage(stp.Ref)
-	if str == nil {
-		return nil, "", fmt.Errorf("storage with ref %s not found", stp.Ref)
+	str, err := r.storage(stp.Ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load storage: %w", err)
 	}
 
 	switch stp.Action {
 	case "lookup.cosine":
-		embedding, err := resolveParam("embedding", stp.Params, vars, false)
+		embedding, err := resolveParamOfKind("embedding", stp.Params, vars, kindEmbedding, false)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'embedding' for storage: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveParamOfKind 'embedding' for storage: %w", err)
 		}
 
-		collection, err := resolveParam("collection", stp.Params, vars, false)
+		collection, err := resolveTextParam("collection", stp.Params, vars)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'collection' for storage: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveTextParam 'collection' for storage: %w", err)
 		}
 
-		limit, err := resolveParam("limit", stp.Params, vars, false)
+		limit, err := resolveTextParam("limit", stp.Params, vars)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'limit' for storage: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveTextParam 'limit' for storage: %w", err)
 		}
 
-		limitInt, err := strconv.Atoi(limit.String)
+		limitInt, err := strconv.Atoi(limit)
 		if err != nil {
 			return nil, "", fmt.Errorf("failed to strconv.Atoi for param 'limit' (must be integer): %w", err)
 		}
 
-		threshold, err := resolveParam("threshold", stp.Params, vars, false)
+		threshold, err := resolveTextParam("threshold", stp.Params, vars)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'threshold' for storage: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveTextParam 'threshold' for storage: %w", err)
 		}
 
-		thresholdFloat, err := strconv.ParseFloat(threshold.String, 32)
+		thresholdFloat, err := strconv.ParseFloat(threshold, 32)
 		if err != nil {
 			return nil, "", fmt.Errorf("failed to ParseFloat for param: threshold (must be decimal): %w", err)
 		}
 
-		res, err := str.LookupCosine(collection.String, embedding.Embedding.Embedding, limitInt, float32(thresholdFloat))
+		res, err := str.LookupCosine(ctx, collection, embedding.Embedding.Embedding, limitInt, float32(thresholdFloat))
 		if err != nil {
 			return nil, "", fmt.Errorf("storage with ref %s resulted in error: %w", stp.Ref, err)
 		}
 
 		mult = &Multivar{Storage: res}
 	case "insert.embedding":
-		embedding, err := resolveParam("embedding", stp.Params, vars, false)
+		embedding, err := resolveParamOfKind("embedding", stp.Params, vars, kindEmbedding, false)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'embedding' for storage: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveParamOfKind 'embedding' for storage: %w", err)
 		}
 
-		collection, err := resolveParam("collection", stp.Params, vars, false)
+		collection, err := resolveTextParam("collection", stp.Params, vars)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'collection' for storage: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveTextParam 'collection' for storage: %w", err)
 		}
 
-		ref, err := resolveParam("ref", stp.Params, vars, false)
+		ref, err := resolveTextParam("ref", stp.Params, vars)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'ref' for storage: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveTextParam 'ref' for storage: %w", err)
 		}
 
-		batchKey, exists := stp.Params["batch"]
-		if !exists {
-			return nil, "", fmt.Errorf("storage with ref %s missing param: batch", stp.Ref)
+		batch, err := resolveTextParam("batch", stp.Params, vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to resolveTextParam 'batch' for storage: %w", err)
 		}
 
-		batch, err := varSubst(batchKey, vars)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to varSubst: %w", err)
+		// the chunk's text is optional, but allows lookups to return what matched
+		chunk := ""
+		if _, exists := stp.Params["chunk"]; exists {
+			chunk, err = resolveTextParam("chunk", stp.Params, vars)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to resolveTextParam 'chunk' for storage: %w", err)
+			}
 		}
 
-		res, err := str.InsertEmbedding(collection.String, ref.String, embedding.Embedding.Embedding, batch.String)
+		res, err := str.InsertEmbedding(ctx, collection, ref, chunk, embedding.Embedding.Embedding, batch)
 		if err != nil {
 			return nil, "", fmt.Errorf("storage with ref %s resulted in error: %w", stp.Ref, err)
 		}
 
 		mult = &Multivar{Storage: res}
 	case "cleanup":
-		batch, err := resolveParam("batch", stp.Params, vars, false)
+		batch, err := resolveTextParam("batch", stp.Params, vars)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'batch' for storage: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveTextParam 'batch' for storage: %w", err)
 		}
 
-		collection, err := resolveParam("collection", stp.Params, vars, false)
+		collection, err := resolveTextParam("collection", stp.Params, vars)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to resolveParam 'collection' for storage: %w", err)
+			return nil, "", fmt.Errorf("failed to resolveTextParam 'collection' for storage: %w", err)
 		}
 
-		if err := str.Cleanup(collection.String, batch.String); err != nil {
+		if err := str.Cleanup(ctx, collection, batch); err != nil {
 			return nil, "", fmt.Errorf("failed to Cleanup: %w", err)
 		}
 	default:
@@ -113,12 +118,32 @@ func (r *Runner) runStorage(stp config.Step, vars map[string]Multivar) (*Multiva
 }
 
 // storage instances are persistent and are reused, unlike other object types (for the time being)
-func (r *Runner) storage(ref string) storage.Storage {
+func (r *Runner) storage(ref string) (storage.Storage, error) {
 	for _, str := range r.config.Storage {
 		if str.Name == ref {
-			return storage.StorageOfType(str.Name, str.Type, str.Config)
+			s, err := storage.StorageOfType(str.Name, str.Type, str.Config)
+			if err != nil {
+				return nil, fmt.Errorf("storage with ref %s is invalid: %w", ref, err)
+			}
+
+			return s, nil
 		}
 	}
 
-	return nil
+	return nil, fmt.Errorf("storage with ref %s not found", ref)
+}
+
+// sessionStore returns the referenced storage, or an error if it can't persist sessions
+func (r *Runner) sessionStore(ref string) (storage.SessionStore, error) {
+	str, err := r.storage(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, ok := str.(storage.SessionStore)
+	if !ok {
+		return nil, fmt.Errorf("storage with ref %s does not support sessions", ref)
+	}
+
+	return sess, nil
 }
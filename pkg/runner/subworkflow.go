@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cohix/ragoo/pkg/config"
+)
+
+const maxSubWorkflowDepth = 8
+
+// subWorkflowDepthKey is the context key for the number of sub-workflow steps currently running
+type subWorkflowDepthKey struct{}
+
+// runSubWorkflow runs the workflow named by the step's ref. Each step param is resolved and passed to
+// the sub-workflow as a var of the same name (with _input defaulting to the parent's _input), except
+// 'export', which lists (comma separated) sub-workflow vars to include in the result's Vars. The result
+// is the sub-workflow's _response
+func (r *Runner) runSubWorkflow(ctx context.Context, stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
+	depth, _ := ctx.Value(subWorkflowDepthKey{}).(int)
+	if depth >= maxSubWorkflowDepth {
+		return nil, "", fmt.Errorf("workflow with ref %s not run: maximum workflow depth of %d reached", stp.Ref, maxSubWorkflowDepth)
+	}
+
+	input := vars[inputKey].String
+	extra := map[string]Multivar{}
+
+	for k := range stp.Params {
+		if k == "export" {
+			continue
+		}
+
+		val, err := resolveParam(k, stp.Params, vars, false)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to resolveParam '%s' for workflow: %w", k, err)
+		}
+
+		if k == inputKey {
+			input = val.String
+			continue
+		}
+
+		extra[k] = *val
+	}
+
+	// only a sub-workflow producing the parent's response may stream it
+	if stp.Var != responseKey {
+		ctx = context.WithValue(ctx, tokenStreamKey{}, nil)
+	}
+
+	ctx = context.WithValue(ctx, subWorkflowDepthKey{}, depth+1)
+
+	res, err := r.runWorkflow(ctx, stp.Ref, map[string]string{inputKey: input}, extra)
+	if err != nil {
+		return nil, "", fmt.Errorf("workflow with ref %s resulted in error: %w", stp.Ref, err)
+	}
+
+	mult, ok := res.Response.(Multivar)
+	if !ok {
+		mult = Multivar{Any: res.Response}
+	}
+
+	if export, exists := stp.Params["export"]; exists {
+		mult.Vars = map[string]Multivar{}
+
+		for _, name := range strings.Split(export, ",") {
+			name = strings.TrimSpace(name)
+
+			v, exists := res.Vars[name]
+			if !exists {
+				return nil, "", fmt.Errorf("workflow with ref %s did not produce exported var %s", stp.Ref, name)
+			}
+
+			mult.Vars[name] = v
+		}
+	}
+
+	key := "workflow"
+	if stp.Var != "" {
+		key = stp.Var
+	}
+
+	return &mult, key, nil
+}
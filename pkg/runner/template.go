@@ -0,0 +1,279 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/cohix/ragoo/pkg/config"
+)
+
+// varRefPattern matches a $name reference to a workflow var in a prompt
+var varRefPattern = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_]*`)
+
+var parsedTemplates = sync.Map{}
+
+// promptFuncs are the helper functions available to prompt templates
+var promptFuncs = template.FuncMap{
+	"text":     func(mv Multivar) string { return responseText(mv) },
+	"join":     joinList,
+	"truncate": truncate,
+	"json":     toJSON,
+	"docs":     numberedDocs,
+	"varText":  varText,
+}
+
+// promptParam returns the prompt given by the step's param with the given key, either inline or loaded
+// from the file named by the param '<key>File', rendered by renderPrompt. A param that is only a reference
+// to a var (e.g. $_input or $_input.json.question) is used verbatim, so that input is never interpreted as a template
+func promptParam(key string, params map[string]string, vars map[string]Multivar, optional bool) (string, bool, error) {
+	src, exists, err := promptSource(key, params)
+	if err != nil {
+		return "", false, err
+	}
+
+	if !exists {
+		if optional {
+			return "", false, nil
+		}
+
+		return "", false, fmt.Errorf("param not found: %s (or %sFile)", key, key)
+	}
+
+	if isVarRef(src) {
+		mv, err := varSubst(src, vars)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to varSubst: %w", err)
+		}
+
+		return responseText(*mv), true, nil
+	}
+
+	prompt, err := renderPrompt(src, vars)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to renderPrompt: %w", err)
+	}
+
+	return prompt, true, nil
+}
+
+// promptSource returns the unrendered prompt given by the param key or the file named by the param '<key>File'
+func promptSource(key string, params map[string]string) (string, bool, error) {
+	src, exists := params[key]
+
+	file, fileExists := params[key+"File"]
+	if exists && fileExists {
+		return "", false, fmt.Errorf("only one of params %s and %sFile may be set", key, key)
+	}
+
+	if fileExists {
+		srcBytes, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to ReadFile for param %sFile: %w", key, err)
+		}
+
+		return string(srcBytes), true, nil
+	}
+
+	return src, exists, nil
+}
+
+// validatePrompts checks that the prompt templates of a service or respond step can be loaded and parsed
+func validatePrompts(stp config.Step) error {
+	key := "prompt"
+	if stp.Type == "respond" {
+		key = "response"
+	} else if stp.Type != "service" {
+		return nil
+	}
+
+	src, exists, err := promptSource(key, stp.Params)
+	if err != nil {
+		return err
+	}
+
+	if !exists || isVarRef(src) {
+		return nil
+	}
+
+	if _, err := parsePrompt(src); err != nil {
+		return fmt.Errorf("failed to parsePrompt: %w", err)
+	}
+
+	return nil
+}
+
+// renderPrompt renders a prompt as a Go text/template with the workflow vars as its data, so that any
+// field of a var is available (e.g. {{ .refs.Storage.Refs | join ", " }}). Outside of template actions,
+// $name is replaced with the text of the var with that name, or left as is if there is no such var
+func renderPrompt(src string, vars map[string]Multivar) (string, error) {
+	tmpl, err := parsePrompt(src)
+	if err != nil {
+		return "", err
+	}
+
+	builder := &strings.Builder{}
+	if err := tmpl.Execute(builder, vars); err != nil {
+		return "", fmt.Errorf("failed to Execute: %w", err)
+	}
+
+	return builder.String(), nil
+}
+
+// parsePrompt parses a prompt template, caching the result since the same prompts are rendered on every run
+func parsePrompt(src string) (*template.Template, error) {
+	if cached, ok := parsedTemplates.Load(src); ok {
+		return cached.(*template.Template), nil
+	}
+
+	tmpl, err := template.New("prompt").Funcs(promptFuncs).Option("missingkey=zero").Parse(expandVarRefs(src))
+	if err != nil {
+		return nil, fmt.Errorf("failed to Parse: %w", err)
+	}
+
+	parsedTemplates.Store(src, tmpl)
+
+	return tmpl, nil
+}
+
+// expandVarRefs turns each $name outside of template actions into an action that renders the var's text.
+// Since vars are only ever rendered by the template, their contents are never parsed as templates themselves
+func expandVarRefs(src string) string {
+	builder := &strings.Builder{}
+
+	for src != "" {
+		start := strings.Index(src, "{{")
+		if start == -1 {
+			start = len(src)
+		}
+
+		builder.WriteString(varRefPattern.ReplaceAllStringFunc(src[:start], func(ref string) string {
+			return fmt.Sprintf("{{ varText $ %q }}", strings.TrimPrefix(ref, "$"))
+		}))
+
+		src = src[start:]
+		if src == "" {
+			break
+		}
+
+		end := strings.Index(src, "}}")
+		if end == -1 {
+			// leave the unclosed action for Parse to report
+			builder.WriteString(src)
+			break
+		}
+
+		builder.WriteString(src[:end+2])
+		src = src[end+2:]
+	}
+
+	return builder.String()
+}
+
+func isVarRef(src string) bool {
+	return varPathPattern.MatchString(src)
+}
+
+func varText(vars map[string]Multivar, name string) string {
+	mv, exists := vars[name]
+	if !exists {
+		return "$" + name
+	}
+
+	return responseText(mv)
+}
+
+// joinList joins the text of each element of a list (e.g. .refs.Storage.Refs or .summaries.List)
+func joinList(sep string, list any) (string, error) {
+	items, err := textItems(list)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(items, sep), nil
+}
+
+func textItems(list any) ([]string, error) {
+	if mv, ok := list.(Multivar); ok {
+		items, err := listItems(&mv)
+		if err != nil {
+			return nil, err
+		}
+
+		list = items
+	}
+
+	val := reflect.ValueOf(list)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return nil, fmt.Errorf("cannot join %T", list)
+	}
+
+	items := make([]string, val.Len())
+	for i := range items {
+		switch el := val.Index(i).Interface().(type) {
+		case Multivar:
+			items[i] = responseText(el)
+		default:
+			items[i] = fmt.Sprint(el)
+		}
+	}
+
+	return items, nil
+}
+
+// truncate shortens s to at most n characters, marking that it was cut with an ellipsis
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n]) + "..."
+}
+
+func toJSON(val any) (string, error) {
+	jsonBytes, err := json.Marshal(val)
+	if err != nil {
+		return "", fmt.Errorf("failed to json.Marshal: %w", err)
+	}
+
+	return string(jsonBytes), nil
+}
+
+// numberedDocs renders the documents of a resolve.refs result (or, for a lookup.cosine result, the chunks
+// that matched) as a numbered list, each headed by its ref, so that a model can be asked to cite them by
+// number. The numbers match those of the sources a route returns (see Result.Sources)
+func numberedDocs(mv Multivar) (string, error) {
+	docs := []string{}
+
+	switch {
+	case mv.Importer != nil:
+		docs = mv.Importer.Documents
+	case mv.Storage != nil && len(mv.Storage.Chunks) > 0:
+		docs = mv.Storage.Chunks
+	default:
+		return "", fmt.Errorf("docs requires the result of an importer resolve.refs or storage lookup.cosine step")
+	}
+
+	builder := &strings.Builder{}
+
+	for i, doc := range docs {
+		if i > 0 {
+			builder.WriteString("\n\n")
+		}
+
+		fmt.Fprintf(builder, "[%d]", i+1)
+		if mv.Storage != nil && i < len(mv.Storage.Refs) {
+			fmt.Fprintf(builder, " %s", mv.Storage.Refs[i])
+		}
+
+		fmt.Fprintf(builder, "\n%s", doc)
+	}
+
+	return builder.String(), nil
+}
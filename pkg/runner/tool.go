@@ -0,0 +1,163 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/service"
+	"github.com/cohix/ragoo/pkg/tool"
+)
+
+const defaultMaxToolIterations = 5
+
+// stepTools loads the tools listed (comma separated) in a service step's 'tools' param,
+// returning them by name along with the specs to provide to the model
+func (r *Runner) stepTools(params map[string]string) (map[string]tool.Tool, []service.ToolSpec, error) {
+	list, exists := params["tools"]
+	if !exists || strings.TrimSpace(list) == "" {
+		return nil, nil, nil
+	}
+
+	tools := map[string]tool.Tool{}
+	specs := []service.ToolSpec{}
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+
+		t, cfg, err := r.tool(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load tool: %w", err)
+		}
+
+		tools[name] = t
+		specs = append(specs, service.ToolSpec{
+			Name:        cfg.Name,
+			Description: cfg.Description,
+			Parameters:  cfg.Parameters,
+		})
+	}
+
+	return tools, specs, nil
+}
+
+// maxToolIterations returns the step's 'maxToolIterations' param, or the default if unset. It must be at
+// least 1, since the model has to be called at least once
+func maxToolIterations(params map[string]string) (int, error) {
+	val, exists := params["maxToolIterations"]
+	if !exists {
+		return defaultMaxToolIterations, nil
+	}
+
+	max, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("failed to strconv.Atoi for param 'maxToolIterations' (must be integer): %w", err)
+	}
+
+	if max < 1 {
+		return 0, fmt.Errorf("param 'maxToolIterations' is %d (must be at least 1)", max)
+	}
+
+	return max, nil
+}
+
+// completeWithTools runs the tool calling loop: the model is called, any tools it requests are
+// run and their results fed back to it, until it produces an answer without calling any tools or
+// maxIter calls have been made. It returns the final result and the conversation leading up to it
+func (r *Runner) completeWithTools(ctx context.Context, srv service.Service, req service.Request, tools map[string]tool.Tool, maxIter int) (*service.Result, []service.Message, error) {
+	if len(req.Messages) == 0 {
+		req.Messages = []service.Message{{Role: service.RoleUser, Content: req.Prompt}}
+		req.Prompt = ""
+	}
+
+	for i := 0; i < maxIter; i++ {
+		res, err := srv.Completion(ctx, req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to Completion: %w", err)
+		}
+
+		if len(res.ToolCalls) == 0 {
+			return res, req.Messages, nil
+		}
+
+		req.Messages = append(req.Messages, service.Message{
+			Role:      service.RoleAssistant,
+			Content:   res.Completion,
+			ToolCalls: res.ToolCalls,
+		})
+
+		for _, call := range res.ToolCalls {
+			output, err := callTool(ctx, tools, call)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to callTool: %w", err)
+			}
+
+			req.Messages = append(req.Messages, service.Message{
+				Role:       service.RoleTool,
+				Content:    output,
+				ToolCallID: call.ID,
+				ToolName:   call.Name,
+			})
+		}
+	}
+
+	return nil, nil, fmt.Errorf("model did not produce a final answer within %d tool iterations", maxIter)
+}
+
+// callTool runs the requested tool and returns its output for the model. Tool failures are returned
+// as output so the model can react to them; only cancellation of ctx is returned as an error
+func callTool(ctx context.Context, tools map[string]tool.Tool, call service.ToolCall) (string, error) {
+	t, exists := tools[call.Name]
+	if !exists {
+		return fmt.Sprintf("error: tool %s is not available", call.Name), nil
+	}
+
+	slog.Info("calling tool", "name", call.Name, "id", call.ID)
+
+	res, err := t.Call(ctx, call.Arguments)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		slog.Error(fmt.Errorf("tool %s resulted in error: %w", call.Name, err).Error())
+
+		return fmt.Sprintf("error: %s", err.Error()), nil
+	}
+
+	if res.IsError {
+		return fmt.Sprintf("error: %s", res.Output), nil
+	}
+
+	return res.Output, nil
+}
+
+func (r *Runner) tool(ref string) (tool.Tool, *config.Tool, error) {
+	for i, t := range r.config.Tools {
+		if t.Name != ref {
+			continue
+		}
+
+		// workflow tools need the runner, so they're created here rather than by the tool package
+		if t.Type == "workflow" {
+			impl, err := r.newWorkflowTool(t.Config)
+			if err != nil {
+				return nil, nil, fmt.Errorf("tool with ref %s is invalid: %w", ref, err)
+			}
+
+			return impl, &r.config.Tools[i], nil
+		}
+
+		impl, err := tool.ToolOfType(t.Type, t.Config)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tool with ref %s is invalid: %w", ref, err)
+		}
+
+		return impl, &r.config.Tools[i], nil
+	}
+
+	return nil, nil, fmt.Errorf("tool with ref %s not found", ref)
+}
@@ -1,9 +1,11 @@
 package runner
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/cohix/ragoo/pkg/config"
 )
@@ -14,25 +16,57 @@ const (
 	chunkKey    = "_chunk"
 	refKey      = "_ref"
 	batchKey    = "_batch"
+	historyKey  = "_history"
 )
 
+// tokenStreamKey is the context key for the token callback set by WithTokenStream
+type tokenStreamKey struct{}
+
+// WithTokenStream returns a context which, when passed to RunWorkflow, causes the tokens of the
+// service step that produces _response to be streamed to onToken as they are generated
+func WithTokenStream(ctx context.Context, onToken func(string) error) context.Context {
+	return context.WithValue(ctx, tokenStreamKey{}, onToken)
+}
+
 // RunWorkflow runs the named workflow with the given params
-func (r *Runner) RunWorkflow(ref string, params map[string]string) (*Result, error) {
+func (r *Runner) RunWorkflow(ctx context.Context, ref string, params map[string]string) (*Result, error) {
+	return r.runWorkflow(ctx, ref, params, nil)
+}
+
+// runWorkflow runs the named workflow, seeding its vars with the given params and any extra vars
+func (r *Runner) runWorkflow(ctx context.Context, ref string, params map[string]string, extra map[string]Multivar) (*Result, error) {
 	wrk := r.workflowFromConfig(ref)
 	if wrk == nil {
 		return nil, fmt.Errorf("workflow with ref %s not found", ref)
 	}
 
+	ctx, cancel, err := withTimeout(ctx, wrk.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("workflow with ref %s has invalid timeout: %w", wrk.Name, err)
+	}
+
+	defer cancel()
+
 	input, exists := params[inputKey]
 	if !exists {
 		return nil, fmt.Errorf("no input provided in workflow params")
 	}
 
-	// seed the vars with the "built in" _input var
+	// seed the vars with the "built in" _input var and any other params
 	vars := map[string]Multivar{
 		inputKey: {String: input, Bytes: []byte(input)},
 	}
 
+	for k, v := range params {
+		if k != inputKey {
+			vars[k] = Multivar{String: v}
+		}
+	}
+
+	for k, v := range extra {
+		vars[k] = v
+	}
+
 	if len(wrk.Stages) == 0 {
 		return nil, fmt.Errorf("workflow with ref %s contains no stages", wrk.Name)
 	}
@@ -43,42 +77,23 @@ func (r *Runner) RunWorkflow(ref string, params map[string]string) (*Result, err
 			continue
 		}
 
-		for _, stp := range stg.Steps {
-			switch stp.Type {
-			case "embedder":
-				mult, key, err := r.runEmbedder(stp, vars)
-				if err != nil {
-					return nil, fmt.Errorf("failed to runEmbedder: %w", err)
-				}
-
-				vars[key] = *mult
-
-			case "storage":
-				mult, key, err := r.runStorage(stp, vars)
-				if err != nil {
-					return nil, fmt.Errorf("failed to runStorage: %w", err)
-				}
-
-				vars[key] = *mult
-
-			case "service":
-				mult, key, err := r.runService(stp, vars)
-				if err != nil {
-					return nil, fmt.Errorf("failed to runService: %w", err)
-				}
-
-				vars[key] = *mult
-
-			case "importer":
-				mult, key, err := r.runImporter(stp, vars)
-				if err != nil {
-					return nil, fmt.Errorf("failed to runImporter: %w", err)
-				}
-
-				vars[key] = *mult
-			default:
-				return nil, fmt.Errorf("workflow step has invalid type %s", stp.Type)
-			}
+		run, err := evalWhen(stg.When, vars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evalWhen for stage %s: %w", stg.Name, err)
+		}
+
+		if !run {
+			slog.Debug("workflow stage condition not met, skipping", "name", stg.Name, "when", stg.When)
+			continue
+		}
+
+		responded, err := r.runStage(ctx, stg, vars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to runStage %s: %w", stg.Name, err)
+		}
+
+		if responded {
+			break
 		}
 	}
 
@@ -95,6 +110,104 @@ func (r *Runner) RunWorkflow(ref string, params map[string]string) (*Result, err
 	return res, nil
 }
 
+// runStepOnce runs a single step of any type, bounding it by the step's timeout if one is set
+func (r *Runner) runStepOnce(ctx context.Context, stp config.Step, vars map[string]Multivar) (*Multivar, string, error) {
+	ctx, cancel, err := withTimeout(ctx, stp.Timeout)
+	if err != nil {
+		return nil, "", fmt.Errorf("step with ref %s has invalid timeout: %w", stp.Ref, err)
+	}
+
+	defer cancel()
+
+	switch stp.Type {
+	case "embedder":
+		mult, key, err := r.runEmbedder(ctx, stp, vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to runEmbedder: %w", err)
+		}
+
+		return mult, key, nil
+
+	case "storage":
+		mult, key, err := r.runStorage(ctx, stp, vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to runStorage: %w", err)
+		}
+
+		return mult, key, nil
+
+	case "service":
+		mult, key, err := r.runService(ctx, stp, vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to runService: %w", err)
+		}
+
+		return mult, key, nil
+
+	case "importer":
+		mult, key, err := r.runImporter(ctx, stp, vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to runImporter: %w", err)
+		}
+
+		return mult, key, nil
+
+	case "workflow":
+		mult, key, err := r.runSubWorkflow(ctx, stp, vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to runSubWorkflow: %w", err)
+		}
+
+		return mult, key, nil
+
+	case "foreach":
+		mult, key, err := r.runForeach(ctx, stp, vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to runForeach: %w", err)
+		}
+
+		return mult, key, nil
+
+	case "respond":
+		mult, key, err := r.runRespond(ctx, stp, vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to runRespond: %w", err)
+		}
+
+		return mult, key, nil
+	}
+
+	return nil, "", fmt.Errorf("workflow step has invalid type %s", stp.Type)
+}
+
+// withTimeout returns a child of ctx that is cancelled after the given duration (e.g. "30s"),
+// or a plain cancellable child if no timeout is set
+func withTimeout(ctx context.Context, timeout string) (context.Context, context.CancelFunc, error) {
+	if timeout == "" {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+
+	dur, err := parseTimeout(timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dur)
+
+	return ctx, cancel, nil
+}
+
+// parseTimeout parses a workflow or step timeout (e.g. "10s")
+func parseTimeout(timeout string) (time.Duration, error) {
+	dur, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to ParseDuration: %w", err)
+	}
+
+	return dur, nil
+}
+
 func (r *Runner) workflowFromConfig(ref string) *config.Workflow {
 	for i, w := range r.config.Workflows {
 		if w.Name == ref {
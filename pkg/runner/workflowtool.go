@@ -0,0 +1,105 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cohix/ragoo/pkg/tool"
+)
+
+const defaultMaxWorkflowDepth = 3
+
+// workflowToolDepthKey is the context key for the number of workflows-as-tools currently running. It is
+// counted separately from sub-workflow steps (see subWorkflowDepthKey), so that maxDepth only limits the
+// nesting of workflow tools
+type workflowToolDepthKey struct{}
+
+// workflowTool exposes a workflow as a tool, allowing the model in one workflow to run another.
+// Its config supports the keys workflow (required) and maxDepth, which limits how deeply
+// workflow tools may be nested (e.g. a workflow calling itself)
+type workflowTool struct {
+	runner   *Runner
+	ref      string
+	maxDepth int
+}
+
+func (r *Runner) newWorkflowTool(cfg map[string]string) (*workflowTool, error) {
+	ref, exists := cfg["workflow"]
+	if !exists || ref == "" {
+		return nil, errors.New("workflow tool missing config key: workflow")
+	}
+
+	if r.workflowFromConfig(ref) == nil {
+		return nil, fmt.Errorf("workflow with ref %s not found", ref)
+	}
+
+	w := &workflowTool{
+		runner:   r,
+		ref:      ref,
+		maxDepth: defaultMaxWorkflowDepth,
+	}
+
+	if depth, exists := cfg["maxDepth"]; exists {
+		d, err := strconv.Atoi(depth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to strconv.Atoi for config key 'maxDepth' (must be integer): %w", err)
+		}
+
+		w.maxDepth = d
+	}
+
+	return w, nil
+}
+
+// Call runs the workflow. If the arguments contain an 'input' string it becomes the workflow's
+// _input, otherwise the arguments themselves do, and each top-level argument is also passed as a param.
+// Arguments starting with _ are reported to the model as an error, since they would set built-in vars
+func (w *workflowTool) Call(ctx context.Context, args json.RawMessage) (*tool.Result, error) {
+	depth, _ := ctx.Value(workflowToolDepthKey{}).(int)
+	if depth >= w.maxDepth {
+		return &tool.Result{
+			Output:  fmt.Sprintf("workflow %s not run: maximum workflow depth of %d reached", w.ref, w.maxDepth),
+			IsError: true,
+		}, nil
+	}
+
+	params := map[string]string{inputKey: string(args)}
+
+	argMap := map[string]any{}
+	if err := json.Unmarshal(args, &argMap); err == nil {
+		for k, v := range argMap {
+			if strings.HasPrefix(k, "_") {
+				return &tool.Result{
+					Output:  fmt.Sprintf("argument '%s' is reserved", k),
+					IsError: true,
+				}, nil
+			}
+
+			if s, ok := v.(string); ok {
+				params[k] = s
+			} else {
+				b, _ := json.Marshal(v)
+				params[k] = string(b)
+			}
+		}
+
+		if input, ok := argMap["input"].(string); ok {
+			params[inputKey] = input
+		}
+	}
+
+	// the nested workflow's response goes to the model rather than being streamed to the client
+	ctx = context.WithValue(ctx, tokenStreamKey{}, nil)
+	ctx = context.WithValue(ctx, workflowToolDepthKey{}, depth+1)
+
+	res, err := w.runner.RunWorkflow(ctx, w.ref, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to RunWorkflow %s: %w", w.ref, err)
+	}
+
+	return &tool.Result{Output: responseText(res.Response)}, nil
+}
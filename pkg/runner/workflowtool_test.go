@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cohix/ragoo/pkg/config"
+)
+
+func TestWorkflowToolDepth(t *testing.T) {
+	cfg := &config.Config{
+		Workflows: []config.Workflow{{
+			Name: "echo",
+			Stages: []config.Stage{{
+				Name:  "answer",
+				Steps: []config.Step{{Type: "respond", Params: map[string]string{"response": "echoed $_input"}}},
+			}},
+		}},
+	}
+
+	rn, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to New: %s", err)
+	}
+
+	wt, err := rn.newWorkflowTool(map[string]string{"workflow": "echo", "maxDepth": "2"})
+	if err != nil {
+		t.Fatalf("failed to newWorkflowTool: %s", err)
+	}
+
+	cases := []struct {
+		name      string
+		ctx       context.Context
+		wantError bool
+	}{
+		{name: "top level", ctx: context.Background()},
+		{name: "within sub-workflows", ctx: context.WithValue(context.Background(), subWorkflowDepthKey{}, 5)},
+		{name: "within one workflow tool", ctx: context.WithValue(context.Background(), workflowToolDepthKey{}, 1)},
+		{name: "at maxDepth", ctx: context.WithValue(context.Background(), workflowToolDepthKey{}, 2), wantError: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := wt.Call(tc.ctx, []byte(`{"input": "hi"}`))
+			if err != nil {
+				t.Fatalf("failed to Call: %s", err)
+			}
+
+			if res.IsError != tc.wantError {
+				t.Fatalf("got result %+v, want IsError %v", res, tc.wantError)
+			}
+
+			if !tc.wantError && res.Output != "echoed hi" {
+				t.Errorf("got output %q, want %q", res.Output, "echoed hi")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/runner"
+)
+
+const (
+	healthPath = "/healthz"
+	readyPath  = "/readyz"
+	adminPath  = "/admin/"
+
+	// how long the readiness checks may take in total
+	readyTimeout = 5 * time.Second
+)
+
+// readyBody is the response body of the readiness endpoint
+type readyBody struct {
+	Ready  bool           `json:"ready"`
+	Checks []runner.Check `json:"checks"`
+}
+
+// adminRoute describes a configured route, omitting its params
+type adminRoute struct {
+	Path     string `json:"path"`
+	Workflow string `json:"workflow"`
+	Stream   bool   `json:"stream"`
+	Session  bool   `json:"session"`
+}
+
+// adminWorkflow describes a configured workflow and its stages
+type adminWorkflow struct {
+	Name    string       `json:"name"`
+	Timeout string       `json:"timeout,omitempty"`
+	Stages  []adminStage `json:"stages"`
+}
+
+type adminStage struct {
+	Name     string `json:"name"`
+	Parallel bool   `json:"parallel"`
+	When     string `json:"when,omitempty"`
+	Steps    int    `json:"steps"`
+}
+
+// reservedPath returns whether path (without the base path) is used by the built-in endpoints
+func reservedPath(path string) bool {
+	return path == healthPath || path == readyPath || strings.HasPrefix(path, adminPath)
+}
+
+// handleBuiltins adds the health, readiness, and (if enabled) admin endpoints to mux. The admin
+// endpoints have no auth of their own, so they are off unless enabled for trusted networks
+func (s *Server) handleBuiltins(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+s.basePath+healthPath, s.handleHealth)
+	mux.HandleFunc("GET "+s.basePath+readyPath, s.handleReady)
+
+	if !s.config.Server.EnableAdmin {
+		return
+	}
+
+	mux.HandleFunc("GET "+s.basePath+adminPath+"routes", s.handleAdminRoutes)
+	mux.HandleFunc("GET "+s.basePath+adminPath+"workflows", s.handleAdminWorkflows)
+	mux.HandleFunc("GET "+s.basePath+adminPath+"importers", s.handleAdminImporters)
+}
+
+// handleHealth reports that the server is up, without checking anything it depends on
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady checks the configured services, embedders, and storage, responding 503 if any critical
+// check fails. Unless the admin endpoints are enabled, the checks' errors are only logged (by CheckReady),
+// since they may contain details of the configuration and backend responses
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	checks, ready := s.runner.CheckReady(ctx)
+
+	if !s.config.Server.EnableAdmin {
+		for i := range checks {
+			checks[i].Error = ""
+		}
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, readyBody{Ready: ready, Checks: checks})
+}
+
+func (s *Server) handleAdminRoutes(w http.ResponseWriter, r *http.Request) {
+	routes := []adminRoute{}
+
+	for _, rt := range s.config.Routes {
+		routes = append(routes, adminRoute{
+			Path:     s.basePath + rt.Path,
+			Workflow: rt.Workflow.Ref,
+			Stream:   rt.Stream,
+			Session:  rt.Session != nil,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"routes": routes})
+}
+
+func (s *Server) handleAdminWorkflows(w http.ResponseWriter, r *http.Request) {
+	workflows := []adminWorkflow{}
+
+	for _, wrk := range s.config.Workflows {
+		workflows = append(workflows, adminWorkflowOf(wrk))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"workflows": workflows})
+}
+
+// handleAdminImporters lists the importers with the status of their current or most recent batch
+func (s *Server) handleAdminImporters(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"importers": s.runner.ImporterStatuses()})
+}
+
+func adminWorkflowOf(wrk config.Workflow) adminWorkflow {
+	aw := adminWorkflow{
+		Name:    wrk.Name,
+		Timeout: wrk.Timeout,
+		Stages:  []adminStage{},
+	}
+
+	for _, stg := range wrk.Stages {
+		aw.Stages = append(aw.Stages, adminStage{
+			Name:     stg.Name,
+			Parallel: stg.Parallel,
+			When:     stg.When,
+			Steps:    len(stg.Steps),
+		})
+	}
+
+	return aw
+}
+
+// checkReservedPaths returns an error if a configured route would clash with a built-in endpoint
+func checkReservedPaths(routes []config.Route) error {
+	for _, r := range routes {
+		if reservedPath(r.Path) {
+			return fmt.Errorf("route path %s is reserved for the built-in health and admin endpoints", r.Path)
+		}
+	}
+
+	return nil
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -11,48 +14,96 @@ import (
 	"github.com/cohix/ragoo/pkg/runner"
 )
 
+const defaultSessionHeader = "X-Session-Id"
+
+// runFunc runs a route's workflow
+type runFunc func(ctx context.Context) (*runner.Result, error)
+
 func (s *Server) handlerForRoute(route config.Route) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rn, err := runner.New(s.config)
-		if err != nil {
-			slog.Error(fmt.Errorf("failed to runner.New: %w", err).Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
 		defer func() {
 			if err := r.Body.Close(); err != nil {
 				slog.Error(fmt.Errorf("failed to Body.Close: %w", err).Error())
 			}
 		}()
 
-		inputBuf, err := io.ReadAll(r.Body)
+		inputBuf, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodyBytes))
 		if err != nil {
+			if maxErr := (&http.MaxBytesError{}); errors.As(err, &maxErr) {
+				writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body must be at most %d bytes", maxErr.Limit))
+				return
+			}
+
 			slog.Error(fmt.Errorf("failed to ReadAll: %w", err).Error())
-			w.WriteHeader(http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, "failed to read request body")
 			return
 		}
 
-		params := route.Workflow.Params
-		if params == nil {
-			params = map[string]string{}
+		params, err := workflowParams(route, r, inputBuf)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		run := func(ctx context.Context) (*runner.Result, error) {
+			return s.runner.RunWorkflow(ctx, route.Workflow.Ref, params)
+		}
+
+		if route.Session != nil {
+			header := route.Session.Header
+			if header == "" {
+				header = defaultSessionHeader
+			}
+
+			// start a new session if the client didn't provide one, and let it know the ID
+			sessionID := r.Header.Get(header)
+			if sessionID == "" {
+				sessionID, err = newSessionID()
+				if err != nil {
+					slog.Error(fmt.Errorf("failed to newSessionID: %w", err).Error())
+					writeError(w, http.StatusInternalServerError, "failed to start session")
+					return
+				}
+			}
+
+			w.Header().Set(header, sessionID)
+
+			run = func(ctx context.Context) (*runner.Result, error) {
+				return s.runner.RunWorkflowInSession(ctx, *route.Session, sessionID, route.Workflow.Ref, params)
+			}
 		}
 
-		params["_input"] = string(inputBuf)
+		if wantsStream(route, r) {
+			streamWorkflow(w, r, route, run)
+			return
+		}
 
-		result, err := rn.RunWorkflow(route.Workflow.Ref, params)
+		result, err := run(r.Context())
 		if err != nil {
 			slog.Error(fmt.Errorf("failed to RunWorkflow: %w", err).Error())
-			w.WriteHeader(http.StatusInternalServerError)
+			status, msg := workflowError(err)
+			writeError(w, status, msg)
 			return
 		}
 
 		slog.Info("workflow completed", "name", route.Workflow.Ref)
 
-		if err := json.NewEncoder(w).Encode(result.Response); err != nil {
-			slog.Error(fmt.Errorf("failed to NewEncoder.Encode: %w", err).Error())
-			w.WriteHeader(http.StatusInternalServerError)
+		output, err := routeOutput(route, result)
+		if err != nil {
+			slog.Error(fmt.Errorf("failed to routeOutput: %w", err).Error())
+			writeError(w, http.StatusInternalServerError, "failed to build response")
 			return
 		}
+
+		writeJSON(w, http.StatusOK, output)
 	}
 }
+
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to rand.Read: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
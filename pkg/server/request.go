@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/cohix/ragoo/pkg/config"
+)
+
+const inputParam = "_input"
+
+// workflowParams returns the params for one run of the route's workflow: a copy of its configured params,
+// plus each field of a JSON object body (strings as is, other values as JSON). Configured params take
+// precedence over fields, and fields may not set built-in vars (those starting with _). _input is the
+// whole body, or the field named by the route's Input
+func workflowParams(route config.Route, r *http.Request, body []byte) (map[string]string, error) {
+	params := map[string]string{}
+	for k, v := range route.Workflow.Params {
+		params[k] = v
+	}
+
+	params[inputParam] = string(body)
+
+	if !isJSON(r) && route.Input == "" {
+		return params, nil
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		if route.Input != "" {
+			return nil, fmt.Errorf("request body must be a JSON object with field '%s'", route.Input)
+		}
+
+		// other JSON (e.g. a list of messages) is left for the workflow to interpret
+		return params, nil
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return nil, fmt.Errorf("request body is not valid JSON: %w", err)
+	}
+
+	for name, raw := range fields {
+		if strings.HasPrefix(name, "_") {
+			return nil, fmt.Errorf("request body field '%s' is reserved", name)
+		}
+
+		if _, exists := route.Workflow.Params[name]; exists {
+			continue
+		}
+
+		params[name] = fieldValue(raw)
+	}
+
+	if route.Input != "" {
+		raw, exists := fields[route.Input]
+		if !exists {
+			return nil, fmt.Errorf("request body is missing field '%s'", route.Input)
+		}
+
+		params[inputParam] = fieldValue(raw)
+	}
+
+	return params, nil
+}
+
+// fieldValue returns a JSON string's contents, or any other JSON value as is
+func fieldValue(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	return string(raw)
+}
+
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
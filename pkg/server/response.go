@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/runner"
+)
+
+// errorBody is the JSON body of an error response, and the data of an SSE error event
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes v as the JSON body of a response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(v); err != nil {
+		slog.Error(fmt.Errorf("failed to NewEncoder.Encode: %w", err).Error())
+	}
+}
+
+// writeError writes an error response with a JSON body such as {"error": "workflow failed"}
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorBody{Error: msg})
+}
+
+// routeOutput returns the body of a route's response to a workflow result
+func routeOutput(route config.Route, result *runner.Result) (map[string]any, error) {
+	output, err := result.Output(route.Output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Output: %w", err)
+	}
+
+	if route.Sources != "" {
+		sources, err := result.Sources(route.Sources)
+		if err != nil {
+			return nil, fmt.Errorf("failed to Sources: %w", err)
+		}
+
+		output["sources"] = sources
+	}
+
+	return output, nil
+}
+
+// workflowError returns the status and client-facing message for a failed workflow run. The
+// underlying error is only logged, since it may contain details of the configuration
+func workflowError(err error) (int, string) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, "workflow timed out"
+	}
+
+	return http.StatusInternalServerError, "workflow failed"
+}
@@ -1,44 +1,202 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/runner"
 )
 
+const (
+	defaultAddress         = ":4141"
+	defaultReadTimeout     = 30 * time.Second
+	defaultIdleTimeout     = 2 * time.Minute
+	defaultShutdownTimeout = 30 * time.Second
+	defaultMaxBodyBytes    = 4 << 20
+
+	// headers must arrive promptly even when the body is allowed longer
+	readHeaderTimeout = 10 * time.Second
+
+	// how long handlers are given to return once their requests are cancelled at shutdown
+	handlerExitTimeout = 5 * time.Second
+)
+
+// ErrHandlersRunning is returned by Shutdown if handlers are still running after being cancelled
+var ErrHandlersRunning = errors.New("handlers still running")
+
 type Server struct {
-	config *config.Config
+	config          *config.Config
+	runner          *runner.Runner // runs the routes' workflows and the importers, shared by all requests
+	srv             *http.Server
+	shutdownTimeout time.Duration
+	maxBodyBytes    int64
+	basePath        string
+
+	// the base of every request's context, cancelled to abort requests still running at shutdown
+	baseCtx    context.Context
+	cancelBase context.CancelFunc
+
+	// tracks running handlers, which srv.Close doesn't wait for
+	handlers sync.WaitGroup
 }
 
-// New returns a new server
-func New(config *config.Config) (*Server, error) {
+// New returns a new server. Unless configured otherwise, it listens on :4141, allows 30s to read
+// a request and 4MB request bodies, closes idle connections after 2m, and waits up to 30s for requests
+// to complete when shut down. There is no write timeout by default, since workflows (and especially
+// streamed responses) can legitimately take a long time. Alongside the configured routes, the
+// server provides /healthz, /readyz, and /admin endpoints. Every route's workflow is run by rn, which
+// was validated when created, and the built-in endpoints report on its plugins and importers
+func New(config *config.Config, rn *runner.Runner) (*Server, error) {
+	cfg := config.Server
+
 	s := &Server{
-		config: config,
+		config:          config,
+		runner:          rn,
+		shutdownTimeout: defaultShutdownTimeout,
+		maxBodyBytes:    defaultMaxBodyBytes,
+	}
+
+	srv := &http.Server{
+		Addr:              defaultAddress,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       defaultReadTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+	}
+
+	if cfg.Address != "" {
+		srv.Addr = cfg.Address
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("server config must set both or neither of tlsCertFile and tlsKeyFile")
+	}
+
+	timeouts := []struct {
+		name string
+		val  string
+		dest *time.Duration
+	}{
+		{"readTimeout", cfg.ReadTimeout, &srv.ReadTimeout},
+		{"writeTimeout", cfg.WriteTimeout, &srv.WriteTimeout},
+		{"idleTimeout", cfg.IdleTimeout, &srv.IdleTimeout},
+		{"shutdownTimeout", cfg.ShutdownTimeout, &s.shutdownTimeout},
+	}
+
+	for _, t := range timeouts {
+		if t.val == "" {
+			continue
+		}
+
+		dur, err := time.ParseDuration(t.val)
+		if err != nil {
+			return nil, fmt.Errorf("failed to ParseDuration for server config %s: %w", t.name, err)
+		}
+
+		*t.dest = dur
 	}
 
+	if cfg.MaxBodyBytes < 0 {
+		return nil, errors.New("server config maxBodyBytes must not be negative")
+	} else if cfg.MaxBodyBytes > 0 {
+		s.maxBodyBytes = cfg.MaxBodyBytes
+	}
+
+	if base := strings.Trim(cfg.BasePath, "/"); base != "" {
+		s.basePath = "/" + base
+	}
+
+	if err := checkReservedPaths(config.Routes); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+
+	for _, r := range config.Routes {
+		mux.HandleFunc(s.basePath+r.Path, s.handlerForRoute(r))
+	}
+
+	s.handleBuiltins(mux)
+
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+
+	srv.Handler = s.trackHandlers(mux)
+	srv.BaseContext = func(net.Listener) context.Context { return s.baseCtx }
+
+	s.srv = srv
+
 	return s, nil
 }
 
-// Start starts the server
+// Start starts the server, blocking until it fails or is stopped by Shutdown
 func (s *Server) Start() error {
-	mux := http.NewServeMux()
+	tls := s.config.Server.TLSCertFile != ""
 
-	for _, r := range s.config.Routes {
-		mux.HandleFunc(r.Path, s.handlerForRoute(r))
-	}
+	slog.Info("starting server", "addr", s.srv.Addr, "tls", tls, "basePath", s.basePath)
 
-	srv := &http.Server{
-		Handler: mux,
-		Addr:    ":4141",
+	var err error
+	if tls {
+		err = s.srv.ListenAndServeTLS(s.config.Server.TLSCertFile, s.config.Server.TLSKeyFile)
+	} else {
+		err = s.srv.ListenAndServe()
 	}
 
-	slog.Info("starting server", "addr", srv.Addr)
-
-	if err := srv.ListenAndServe(); err != nil {
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("failed to ListenAndServe: %w", err)
 	}
 
 	return nil
 }
+
+// Shutdown stops the server from accepting requests and waits for those in flight to complete. If ctx
+// is done first, the workflows of the remaining requests are cancelled, their connections closed, and
+// their handlers given a few more seconds to return, so that nothing is left using storage once it does
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.srv.Shutdown(ctx)
+
+	s.cancelBase()
+
+	if err == nil {
+		return nil
+	}
+
+	if closeErr := s.srv.Close(); closeErr != nil {
+		slog.Error(fmt.Errorf("failed to Close: %w", closeErr).Error())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(handlerExitTimeout):
+		return fmt.Errorf("%w %s after cancellation: %w", ErrHandlersRunning, handlerExitTimeout, err)
+	}
+
+	return fmt.Errorf("failed to Shutdown: %w", err)
+}
+
+// trackHandlers wraps next so that Shutdown can wait for its running handlers
+func (s *Server) trackHandlers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handlers.Add(1)
+		defer s.handlers.Done()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ShutdownTimeout returns how long to wait for in-flight work when shutting down
+func (s *Server) ShutdownTimeout() time.Duration {
+	return s.shutdownTimeout
+}
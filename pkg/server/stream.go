@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/runner"
+)
+
+const (
+	eventToken = "token"
+	eventDone  = "done"
+	eventError = "error"
+)
+
+// wantsStream returns true if the route's response should be streamed as Server-Sent Events
+func wantsStream(route config.Route, r *http.Request) bool {
+	return route.Stream || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// streamWorkflow runs the route's workflow, sending each token of its response to the client
+// as a 'token' event, followed by a 'done' event with the route's output or an 'error' event
+func streamWorkflow(w http.ResponseWriter, r *http.Request, route config.Route, run runFunc) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		slog.Error("response writer does not support flushing, cannot stream")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	onToken := func(token string) error {
+		return writeEvent(w, flusher, eventToken, token)
+	}
+
+	result, err := run(runner.WithTokenStream(r.Context(), onToken))
+	if err != nil {
+		slog.Error(fmt.Errorf("failed to RunWorkflow: %w", err).Error())
+
+		_, msg := workflowError(err)
+		if err := writeEvent(w, flusher, eventError, errorBody{Error: msg}); err != nil {
+			slog.Error(fmt.Errorf("failed to writeEvent: %w", err).Error())
+		}
+
+		return
+	}
+
+	slog.Info("workflow completed", "name", route.Workflow.Ref, "stream", true)
+
+	output, err := routeOutput(route, result)
+	if err != nil {
+		slog.Error(fmt.Errorf("failed to routeOutput: %w", err).Error())
+
+		if err := writeEvent(w, flusher, eventError, errorBody{Error: "failed to build response"}); err != nil {
+			slog.Error(fmt.Errorf("failed to writeEvent: %w", err).Error())
+		}
+
+		return
+	}
+
+	if err := writeEvent(w, flusher, eventDone, output); err != nil {
+		slog.Error(fmt.Errorf("failed to writeEvent: %w", err).Error())
+	}
+}
+
+// writeEvent writes a single JSON-encoded Server-Sent Event and flushes it to the client
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, event string, data any) error {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to json.Marshal: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, dataBytes); err != nil {
+		return fmt.Errorf("failed to Fprintf: %w", err)
+	}
+
+	flusher.Flush()
+
+	return nil
+}
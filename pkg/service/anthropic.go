@@ -0,0 +1,432 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicDefaultBaseURL   = "https://api.anthropic.com"
+	anthropicDefaultAPIKeyEnv = "ANTHROPIC_API_KEY"
+	anthropicDefaultMaxTokens = 1024
+	anthropicAPIVersion       = "2023-06-01"
+)
+
+// anthropicService speaks the Anthropic Messages API
+type anthropicService struct {
+	config map[string]string
+	apiKey string
+	client *http.Client
+}
+
+// anthropicSettings are the parsed form of an anthropic service's config, which supports the keys
+// baseURL, apiKeyEnv, model (required), system, maxTokens, temperature, topP, topK,
+// stop (one sequence per line), and timeout
+type anthropicSettings struct {
+	baseURL     string
+	model       string
+	system      string
+	maxTokens   int
+	temperature *float64
+	topP        *float64
+	topK        *int
+	stop        []string
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	MaxTokens     int                `json:"max_tokens"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	TopK          *int               `json:"top_k,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string             `json:"role"`
+	Content []anthropicContent `json:"content"`
+}
+
+// anthropicContent is a content block, holding the fields used by the text, tool_use, and tool_result types
+type anthropicContent struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+// anthropicStreamEvent holds the fields used from each of the streamed event types
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type anthropicResponse struct {
+	Content    []anthropicContent `json:"content"`
+	StopReason string             `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func newAnthropicService(cfg map[string]string) (*anthropicService, error) {
+	// parse once up front so that invalid config is caught at startup
+	if _, err := parseAnthropicSettings(cfg); err != nil {
+		return nil, err
+	}
+
+	envVar, exists := cfg["apiKeyEnv"]
+	if !exists {
+		envVar = anthropicDefaultAPIKeyEnv
+	}
+
+	apiKey := os.Getenv(envVar)
+	if apiKey == "" {
+		return nil, fmt.Errorf("anthropic service requires an API key in env var %s", envVar)
+	}
+
+	client := &http.Client{}
+	if timeout, exists := cfg["timeout"]; exists {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to ParseDuration for config key 'timeout': %w", err)
+		}
+
+		client.Timeout = dur
+	}
+
+	a := &anthropicService{
+		config: cfg,
+		apiKey: apiKey,
+		client: client,
+	}
+
+	return a, nil
+}
+
+func parseAnthropicSettings(cfg map[string]string) (*anthropicSettings, error) {
+	model, exists := cfg["model"]
+	if !exists || model == "" {
+		return nil, errors.New("anthropic service missing config key: model")
+	}
+
+	baseURL := anthropicDefaultBaseURL
+	if url, exists := cfg["baseURL"]; exists {
+		baseURL = strings.TrimSuffix(url, "/")
+	}
+
+	s := &anthropicSettings{
+		baseURL:   baseURL,
+		model:     model,
+		system:    cfg["system"],
+		maxTokens: anthropicDefaultMaxTokens,
+	}
+
+	if val, exists := cfg["maxTokens"]; exists {
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("failed to strconv.Atoi for config key 'maxTokens' (must be integer): %w", err)
+		}
+
+		s.maxTokens = i
+	}
+
+	for key, dest := range map[string]**float64{"temperature": &s.temperature, "topP": &s.topP} {
+		if val, exists := cfg[key]; exists {
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to ParseFloat for config key '%s' (must be decimal): %w", key, err)
+			}
+
+			*dest = &f
+		}
+	}
+
+	if val, exists := cfg["topK"]; exists {
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("failed to strconv.Atoi for config key 'topK' (must be integer): %w", err)
+		}
+
+		s.topK = &i
+	}
+
+	if stop, exists := cfg["stop"]; exists {
+		s.stop = strings.Split(strings.TrimSpace(stop), "\n")
+	}
+
+	return s, nil
+}
+
+// Completion generates a completion for the request's prompt or messages
+func (a *anthropicService) Completion(ctx context.Context, req Request) (*Result, error) {
+	settings, err := parseAnthropicSettings(mergeOptions(a.config, req.Options))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parseAnthropicSettings: %w", err)
+	}
+
+	slog.Info("generating completion", "service", "anthropic", "model", settings.model)
+
+	url := settings.baseURL + "/v1/messages"
+
+	// the messages API takes the system prompt separately from the conversation
+	system, msgs := splitSystem(req.messages(settings.system))
+
+	reqBody := &anthropicRequest{
+		Model:         settings.model,
+		MaxTokens:     settings.maxTokens,
+		System:        system,
+		Messages:      toAnthropicMessages(msgs),
+		Tools:         anthropicTools(req.Tools),
+		Temperature:   settings.temperature,
+		TopP:          settings.topP,
+		TopK:          settings.topK,
+		StopSequences: settings.stop,
+		Stream:        req.OnToken != nil,
+	}
+
+	reqBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to json.Marshal: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to NewRequestWithContext: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Api-Key", a.apiKey)
+	httpReq.Header.Set("Anthropic-Version", anthropicAPIVersion)
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Do: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
+	}
+
+	if req.OnToken != nil {
+		return readAnthropicStream(resp.Body, req.OnToken)
+	}
+
+	respBody := &anthropicResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(respBody); err != nil {
+		return nil, fmt.Errorf("failed to NewDecoder.Decode: %w", err)
+	}
+
+	text := []string{}
+	toolCalls := []ToolCall{}
+
+	for _, c := range respBody.Content {
+		switch c.Type {
+		case "text":
+			text = append(text, c.Text)
+		case "tool_use":
+			toolCalls = append(toolCalls, ToolCall{ID: c.ID, Name: c.Name, Arguments: c.Input})
+		}
+	}
+
+	r := &Result{
+		Completion: strings.Join(text, ""),
+		StopReason: respBody.StopReason,
+		ToolCalls:  toolCalls,
+		Usage: &Usage{
+			InputTokens:  respBody.Usage.InputTokens,
+			OutputTokens: respBody.Usage.OutputTokens,
+		},
+	}
+
+	return r, nil
+}
+
+// readAnthropicStream reads a streamed message, which is sent as Server-Sent Events
+func readAnthropicStream(body io.Reader, onToken func(string) error) (*Result, error) {
+	r := &Result{Usage: &Usage{}}
+	completion := strings.Builder{}
+
+	err := readSSE(body, func(_, data string) error {
+		evt := &anthropicStreamEvent{}
+		if err := json.Unmarshal([]byte(data), evt); err != nil {
+			return fmt.Errorf("failed to json.Unmarshal: %w", err)
+		}
+
+		switch evt.Type {
+		case "message_start":
+			r.Usage.InputTokens = evt.Message.Usage.InputTokens
+		case "content_block_delta":
+			if evt.Delta.Type != "text_delta" || evt.Delta.Text == "" {
+				return nil
+			}
+
+			completion.WriteString(evt.Delta.Text)
+
+			if err := onToken(evt.Delta.Text); err != nil {
+				return fmt.Errorf("failed to onToken: %w", err)
+			}
+		case "message_delta":
+			r.StopReason = evt.Delta.StopReason
+			r.Usage.OutputTokens = evt.Usage.OutputTokens
+		case "error":
+			return fmt.Errorf("anthropic stream returned error: %s", evt.Error.Message)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to readSSE: %w", err)
+	}
+
+	r.Completion = completion.String()
+
+	return r, nil
+}
+
+// Check checks that the API is reachable, accepts the API key, and serves the configured model
+func (a *anthropicService) Check(ctx context.Context) error {
+	settings, err := parseAnthropicSettings(a.config)
+	if err != nil {
+		return fmt.Errorf("failed to parseAnthropicSettings: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, settings.baseURL+"/v1/models/"+settings.model, nil)
+	if err != nil {
+		return fmt.Errorf("failed to NewRequestWithContext: %w", err)
+	}
+
+	req.Header.Set("X-Api-Key", a.apiKey)
+	req.Header.Set("Anthropic-Version", anthropicAPIVersion)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to Do: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("model %s is not served", settings.model)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// splitSystem separates any system messages from the rest of the conversation
+func splitSystem(msgs []Message) (string, []Message) {
+	system := []string{}
+	rest := []Message{}
+
+	for _, m := range msgs {
+		if m.Role == RoleSystem {
+			system = append(system, m.Content)
+			continue
+		}
+
+		rest = append(rest, m)
+	}
+
+	return strings.Join(system, "\n\n"), rest
+}
+
+// toAnthropicMessages converts messages into content blocks. Tool results are sent as user
+// messages, and consecutive messages with the same role are merged since roles must alternate
+func toAnthropicMessages(msgs []Message) []anthropicMessage {
+	out := []anthropicMessage{}
+
+	for _, m := range msgs {
+		role := m.Role
+		blocks := []anthropicContent{}
+
+		switch m.Role {
+		case RoleTool:
+			role = RoleUser
+			blocks = append(blocks, anthropicContent{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content})
+		default:
+			if m.Content != "" {
+				blocks = append(blocks, anthropicContent{Type: "text", Text: m.Content})
+			}
+
+			for _, tc := range m.ToolCalls {
+				input := tc.Arguments
+				if len(input) == 0 {
+					input = json.RawMessage("{}")
+				}
+
+				blocks = append(blocks, anthropicContent{Type: "tool_use", ID: tc.ID, Name: tc.Name, Input: input})
+			}
+		}
+
+		if len(out) > 0 && out[len(out)-1].Role == role {
+			out[len(out)-1].Content = append(out[len(out)-1].Content, blocks...)
+			continue
+		}
+
+		out = append(out, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	return out
+}
+
+func anthropicTools(specs []ToolSpec) []anthropicTool {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	tools := make([]anthropicTool, len(specs))
+	for i, s := range specs {
+		schema := s.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+
+		tools[i] = anthropicTool{Name: s.Name, Description: s.Description, InputSchema: schema}
+	}
+
+	return tools
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeAnthropic serves /v1/messages with the given status and body, recording each request
+type fakeAnthropic struct {
+	status int
+	body   string
+
+	header http.Header
+	req    anthropicRequest
+}
+
+func (f *fakeAnthropic) start(t *testing.T) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/messages" {
+			http.NotFound(w, r)
+			return
+		}
+
+		f.header = r.Header.Clone()
+
+		if err := json.NewDecoder(r.Body).Decode(&f.req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(f.status)
+		fmt.Fprint(w, f.body)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+func newTestAnthropicService(t *testing.T, cfg map[string]string) Service {
+	t.Helper()
+
+	t.Setenv(anthropicDefaultAPIKeyEnv, "sk-ant-test")
+
+	srv, err := ServiceOfType("anthropic", cfg)
+	if err != nil {
+		t.Fatalf("failed to ServiceOfType: %s", err)
+	}
+
+	return srv
+}
+
+func TestToAnthropicMessages(t *testing.T) {
+	cases := []struct {
+		name string
+		msgs []Message
+		want string
+	}{
+		{
+			name: "text",
+			msgs: []Message{
+				{Role: RoleUser, Content: "hi"},
+				{Role: RoleAssistant, Content: "hello"},
+			},
+			want: `[{"role":"user","content":[{"type":"text","text":"hi"}]},{"role":"assistant","content":[{"type":"text","text":"hello"}]}]`,
+		},
+		{
+			name: "consecutive roles are merged",
+			msgs: []Message{
+				{Role: RoleUser, Content: "first"},
+				{Role: RoleUser, Content: "second"},
+			},
+			want: `[{"role":"user","content":[{"type":"text","text":"first"},{"type":"text","text":"second"}]}]`,
+		},
+		{
+			name: "tool calls and results",
+			msgs: []Message{
+				{Role: RoleUser, Content: "look it up"},
+				{Role: RoleAssistant, Content: "checking", ToolCalls: []ToolCall{
+					{ID: "tu_1", Name: "lookup", Arguments: json.RawMessage(`{"q":"go"}`)},
+					{ID: "tu_2", Name: "now"},
+				}},
+				{Role: RoleTool, Content: "found it", ToolCallID: "tu_1"},
+				{Role: RoleTool, Content: "noon", ToolCallID: "tu_2"},
+				{Role: RoleUser, Content: "thanks"},
+			},
+			want: `[` +
+				`{"role":"user","content":[{"type":"text","text":"look it up"}]},` +
+				`{"role":"assistant","content":[{"type":"text","text":"checking"},` +
+				`{"type":"tool_use","id":"tu_1","name":"lookup","input":{"q":"go"}},` +
+				`{"type":"tool_use","id":"tu_2","name":"now","input":{}}]},` +
+				`{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu_1","content":"found it"},` +
+				`{"type":"tool_result","tool_use_id":"tu_2","content":"noon"},` +
+				`{"type":"text","text":"thanks"}]}` +
+				`]`,
+		},
+		{
+			name: "tool calls without text",
+			msgs: []Message{
+				{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "tu_1", Name: "now", Arguments: json.RawMessage(`{}`)}}},
+			},
+			want: `[{"role":"assistant","content":[{"type":"tool_use","id":"tu_1","name":"now","input":{}}]}]`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := json.Marshal(toAnthropicMessages(tc.msgs))
+			if err != nil {
+				t.Fatalf("failed to json.Marshal: %s", err)
+			}
+
+			if string(got) != tc.want {
+				t.Errorf("got  %s\nwant %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSplitSystem(t *testing.T) {
+	system, rest := splitSystem([]Message{
+		{Role: RoleSystem, Content: "be brief"},
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleSystem, Content: "be kind"},
+		{Role: RoleAssistant, Content: "hello"},
+	})
+
+	if system != "be brief\n\nbe kind" {
+		t.Errorf("got system %q", system)
+	}
+
+	if len(rest) != 2 || rest[0].Role != RoleUser || rest[1].Role != RoleAssistant {
+		t.Errorf("got messages %+v, want the user and assistant messages", rest)
+	}
+}
+
+func TestReadAnthropicStream(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		tokenErr   error
+		wantText   string
+		wantTokens string
+		wantErr    string
+	}{
+		{
+			name: "text",
+			body: "event: message_start\ndata: {\"type\": \"message_start\", \"message\": {\"usage\": {\"input_tokens\": 12}}}\n\n" +
+				"event: content_block_start\ndata: {\"type\": \"content_block_start\"}\n\n" +
+				"event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"text_delta\", \"text\": \"hel\"}}\n\n" +
+				"event: ping\ndata: {\"type\": \"ping\"}\n\n" +
+				"event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"input_json_delta\", \"partial_json\": \"{}\"}}\n\n" +
+				"event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"text_delta\", \"text\": \"lo\"}}\n\n" +
+				"event: message_delta\ndata: {\"type\": \"message_delta\", \"delta\": {\"stop_reason\": \"end_turn\"}, \"usage\": {\"output_tokens\": 3}}\n\n" +
+				"event: message_stop\ndata: {\"type\": \"message_stop\"}\n\n",
+			wantText:   "hello",
+			wantTokens: "hel|lo",
+		},
+		{
+			name: "error event",
+			body: "event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"text_delta\", \"text\": \"hel\"}}\n\n" +
+				"event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n",
+			wantErr: "anthropic stream returned error: Overloaded",
+		},
+		{
+			name:    "invalid event",
+			body:    "event: message_start\ndata: {not json\n\n",
+			wantErr: "failed to json.Unmarshal",
+		},
+		{
+			name:     "token callback fails",
+			body:     "data: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"text_delta\", \"text\": \"hel\"}}\n\n",
+			tokenErr: errors.New("client went away"),
+			wantErr:  "client went away",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens := []string{}
+
+			res, err := readAnthropicStream(strings.NewReader(tc.body), func(token string) error {
+				tokens = append(tokens, token)
+				return tc.tokenErr
+			})
+
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, want it to contain %q", err, tc.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to readAnthropicStream: %s", err)
+			}
+
+			if res.Completion != tc.wantText || strings.Join(tokens, "|") != tc.wantTokens {
+				t.Errorf("got completion %q and tokens %q, want %q and %q", res.Completion, tokens, tc.wantText, tc.wantTokens)
+			}
+
+			if res.StopReason != "end_turn" || res.Usage.InputTokens != 12 || res.Usage.OutputTokens != 3 {
+				t.Errorf("got stop reason %q and usage %+v", res.StopReason, res.Usage)
+			}
+		})
+	}
+}
+
+func TestAnthropicCompletion(t *testing.T) {
+	fake := &fakeAnthropic{
+		status: http.StatusOK,
+		body: `{
+			"content": [
+				{"type": "text", "text": "let me "},
+				{"type": "text", "text": "check"},
+				{"type": "tool_use", "id": "tu_1", "name": "lookup", "input": {"q": "go"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 20, "output_tokens": 5}
+		}`,
+	}
+
+	srv := newTestAnthropicService(t, map[string]string{"baseURL": fake.start(t) + "/", "model": "claude-test", "system": "be brief"})
+
+	tools := []ToolSpec{{Name: "lookup", Description: "looks things up"}}
+
+	res, err := srv.Completion(context.Background(), Request{Prompt: "find go", Tools: tools})
+	if err != nil {
+		t.Fatalf("failed to Completion: %s", err)
+	}
+
+	if res.Completion != "let me check" || res.StopReason != "tool_use" {
+		t.Errorf("got completion %q with stop reason %q", res.Completion, res.StopReason)
+	}
+
+	if len(res.ToolCalls) != 1 || res.ToolCalls[0].ID != "tu_1" || string(res.ToolCalls[0].Arguments) != `{"q": "go"}` {
+		t.Errorf("got tool calls %+v", res.ToolCalls)
+	}
+
+	if res.Usage == nil || res.Usage.InputTokens != 20 || res.Usage.OutputTokens != 5 {
+		t.Errorf("got usage %+v, want 20 input and 5 output tokens", res.Usage)
+	}
+
+	if got := fake.header.Get("X-Api-Key"); got != "sk-ant-test" {
+		t.Errorf("got X-Api-Key %q, want the key from %s", got, anthropicDefaultAPIKeyEnv)
+	}
+
+	if got := fake.header.Get("Anthropic-Version"); got != anthropicAPIVersion {
+		t.Errorf("got Anthropic-Version %q, want %q", got, anthropicAPIVersion)
+	}
+
+	req := fake.req
+	if req.Model != "claude-test" || req.MaxTokens != anthropicDefaultMaxTokens || req.System != "be brief" {
+		t.Errorf("got model %q, max tokens %d, and system %q", req.Model, req.MaxTokens, req.System)
+	}
+
+	if len(req.Messages) != 1 || req.Messages[0].Role != RoleUser || req.Messages[0].Content[0].Text != "find go" {
+		t.Errorf("got messages %+v, want only the user prompt", req.Messages)
+	}
+
+	if len(req.Tools) != 1 || req.Tools[0].Name != "lookup" || req.Tools[0].InputSchema["type"] != "object" {
+		t.Errorf("got tools %+v, want lookup with an object schema", req.Tools)
+	}
+}
+
+func TestAnthropicAPIKey(t *testing.T) {
+	t.Setenv(anthropicDefaultAPIKeyEnv, "")
+
+	if _, err := ServiceOfType("anthropic", map[string]string{"model": "claude-test"}); err == nil {
+		t.Error("ServiceOfType succeeded without an API key, want error")
+	}
+}
+
+func TestAnthropicErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		body    string
+		stream  bool
+		wantErr string
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, body: `{"type": "error", "error": {"type": "authentication_error"}}`, wantErr: "non-200 status code: 401"},
+		{name: "overloaded", status: 529, body: `{"type": "error", "error": {"type": "overloaded_error"}}`, wantErr: "non-200 status code: 529"},
+		{name: "streamed non-200", status: http.StatusInternalServerError, body: `oops`, stream: true, wantErr: "non-200 status code: 500"},
+		{name: "invalid body", status: http.StatusOK, body: `not json`, wantErr: "failed to NewDecoder.Decode"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeAnthropic{status: tc.status, body: tc.body}
+
+			srv := newTestAnthropicService(t, map[string]string{"baseURL": fake.start(t), "model": "claude-test"})
+
+			req := Request{Prompt: "hi"}
+			if tc.stream {
+				req.OnToken = func(string) error { return nil }
+			}
+
+			_, err := srv.Completion(context.Background(), req)
+			if err == nil {
+				t.Fatalf("Completion succeeded, want error containing %q", tc.wantErr)
+			}
+
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %q, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -2,51 +2,175 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cohix/ragoo/pkg/config"
+	"github.com/cohix/ragoo/pkg/health"
 )
 
+const ollamaDefaultBaseURL = "http://localhost:11434"
+
 type ollamaService struct {
 	config map[string]string
+	client *http.Client
+}
+
+// ollamaSettings are the parsed form of an ollama service's config, which supports the keys
+// baseURL, model (required), system, temperature, topP, numCtx, seed, stop (one sequence per line),
+// format, keepAlive, timeout, and any number of options.<name> keys
+type ollamaSettings struct {
+	baseURL   string
+	model     string
+	system    string
+	format    string
+	keepAlive string
+	options   map[string]any
 }
 
 type ollamaRequest struct {
-	Model    string    `json:"model"`
-	Stream   bool      `json:"stream"`
-	Messages []message `json:"messages"`
+	Model     string          `json:"model"`
+	Stream    bool            `json:"stream"`
+	Messages  []ollamaMessage `json:"messages"`
+	Tools     []functionTool  `json:"tools,omitempty"`
+	Format    string          `json:"format,omitempty"`
+	KeepAlive string          `json:"keep_alive,omitempty"`
+	Options   map[string]any  `json:"options,omitempty"`
 }
 
 type ollamaResponse struct {
-	Message message `json:"message"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
 }
 
-type message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
 }
 
-func (o *ollamaService) Completion(prompt string) (*Result, error) {
-	slog.Info("generating completion", "service", "ollama")
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+func newOllamaService(cfg map[string]string) (*ollamaService, error) {
+	// parse once up front so that invalid config is caught at startup
+	if _, err := parseOllamaSettings(cfg); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{}
+	if timeout, exists := cfg["timeout"]; exists {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to ParseDuration for config key 'timeout': %w", err)
+		}
 
-	model, exists := o.config["model"]
-	if !exists {
+		client.Timeout = dur
+	}
+
+	o := &ollamaService{
+		config: cfg,
+		client: client,
+	}
+
+	return o, nil
+}
+
+func parseOllamaSettings(cfg map[string]string) (*ollamaSettings, error) {
+	model, exists := cfg["model"]
+	if !exists || model == "" {
 		return nil, errors.New("ollama service missing config key: model")
 	}
 
-	url := "http://localhost:11434/api/chat"
+	baseURL := ollamaDefaultBaseURL
+	if url, exists := cfg["baseURL"]; exists {
+		baseURL = strings.TrimSuffix(url, "/")
+	}
+
+	format := cfg["format"]
+	if format != "" && format != "json" {
+		return nil, fmt.Errorf("ollama service has invalid format %s (must be json)", format)
+	}
+
+	s := &ollamaSettings{
+		baseURL:   baseURL,
+		model:     model,
+		system:    cfg["system"],
+		format:    format,
+		keepAlive: cfg["keepAlive"],
+		options:   config.PrefixedValues(cfg, "options."),
+	}
+
+	floats := map[string]string{"temperature": "temperature", "topP": "top_p"}
+	for key, opt := range floats {
+		if val, exists := cfg[key]; exists {
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to ParseFloat for config key '%s' (must be decimal): %w", key, err)
+			}
+
+			s.options[opt] = f
+		}
+	}
+
+	ints := map[string]string{"numCtx": "num_ctx", "seed": "seed"}
+	for key, opt := range ints {
+		if val, exists := cfg[key]; exists {
+			i, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("failed to strconv.Atoi for config key '%s' (must be integer): %w", key, err)
+			}
+
+			s.options[opt] = i
+		}
+	}
+
+	if stop, exists := cfg["stop"]; exists {
+		s.options["stop"] = strings.Split(strings.TrimSpace(stop), "\n")
+	}
+
+	return s, nil
+}
+
+// Completion generates a completion for the request's prompt or messages
+func (o *ollamaService) Completion(ctx context.Context, req Request) (*Result, error) {
+	settings, err := parseOllamaSettings(mergeOptions(o.config, req.Options))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parseOllamaSettings: %w", err)
+	}
+
+	slog.Info("generating completion", "service", "ollama", "model", settings.model)
+
+	url := settings.baseURL + "/api/chat"
+
+	msgs := []ollamaMessage{}
+	for _, m := range req.messages(settings.system) {
+		msgs = append(msgs, toOllamaMessage(m))
+	}
 
 	reqBody := &ollamaRequest{
-		Model:  model,
-		Stream: false,
-		Messages: []message{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
+		Model:     settings.model,
+		Stream:    req.OnToken != nil,
+		Messages:  msgs,
+		Tools:     functionTools(req.Tools),
+		Format:    settings.format,
+		KeepAlive: settings.keepAlive,
+		Options:   settings.options,
 	}
 
 	reqBytes, err := json.Marshal(reqBody)
@@ -54,30 +178,90 @@ func (o *ollamaService) Completion(prompt string) (*Result, error) {
 		return nil, fmt.Errorf("failed to json.Marshal: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBytes))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(reqBytes))
 	if err != nil {
-		return nil, fmt.Errorf("failed to NewRequest: %w", err)
+		return nil, fmt.Errorf("failed to NewRequestWithContext: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := o.client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to Do: %w", err)
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
 	}
 
-	defer resp.Body.Close()
-
+	// when streaming, ollama sends a sequence of newline-delimited JSON objects, the last of which
+	// has done set and carries the usage counts. Otherwise it sends just the one (done) object
+	completion := strings.Builder{}
+	toolCalls := []ToolCall{}
 	respBody := &ollamaResponse{}
-	if err := json.NewDecoder(resp.Body).Decode(respBody); err != nil {
-		return nil, fmt.Errorf("failed to NewDecoder.Decode: %w", err)
+
+	dec := json.NewDecoder(resp.Body)
+	for !respBody.Done {
+		respBody = &ollamaResponse{}
+		if err := dec.Decode(respBody); err != nil {
+			return nil, fmt.Errorf("failed to Decoder.Decode: %w", err)
+		}
+
+		completion.WriteString(respBody.Message.Content)
+
+		// ollama doesn't identify tool calls, so they're numbered in the order received
+		for _, tc := range respBody.Message.ToolCalls {
+			toolCalls = append(toolCalls, ToolCall{
+				ID:        fmt.Sprintf("call_%d", len(toolCalls)),
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			})
+		}
+
+		if req.OnToken != nil && respBody.Message.Content != "" {
+			if err := req.OnToken(respBody.Message.Content); err != nil {
+				return nil, fmt.Errorf("failed to OnToken: %w", err)
+			}
+		}
 	}
 
 	r := &Result{
-		Completion: respBody.Message.Content,
+		Completion: completion.String(),
+		StopReason: respBody.DoneReason,
+		ToolCalls:  toolCalls,
+		Usage: &Usage{
+			InputTokens:  respBody.PromptEvalCount,
+			OutputTokens: respBody.EvalCount,
+		},
 	}
 
 	return r, nil
 }
+
+// Check checks that ollama is reachable and has pulled the configured model
+func (o *ollamaService) Check(ctx context.Context) error {
+	settings, err := parseOllamaSettings(o.config)
+	if err != nil {
+		return fmt.Errorf("failed to parseOllamaSettings: %w", err)
+	}
+
+	return health.CheckOllamaModel(ctx, o.client, settings.baseURL, settings.model)
+}
+
+func toOllamaMessage(m Message) ollamaMessage {
+	om := ollamaMessage{
+		Role:     m.Role,
+		Content:  m.Content,
+		ToolName: m.ToolName,
+	}
+
+	for _, tc := range m.ToolCalls {
+		otc := ollamaToolCall{}
+		otc.Function.Name = tc.Name
+		otc.Function.Arguments = tc.Arguments
+
+		om.ToolCalls = append(om.ToolCalls, otc)
+	}
+
+	return om
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cohix/ragoo/pkg/health"
+)
+
+const openAIDefaultBaseURL = "https://api.openai.com/v1"
+
+// openAIService speaks the OpenAI chat completions wire protocol, which is
+// also served by vLLM, llama.cpp server, LiteLLM, and many other gateways
+type openAIService struct {
+	config map[string]string
+	apiKey string
+	client *http.Client
+}
+
+// openAISettings are the parsed form of an openai service's config, which supports the keys
+// baseURL, apiKeyEnv, model (required), system, temperature, topP, maxTokens, seed,
+// stop (one sequence per line), format, and timeout
+type openAISettings struct {
+	baseURL     string
+	model       string
+	system      string
+	temperature *float64
+	topP        *float64
+	maxTokens   *int
+	seed        *int
+	stop        []string
+	format      string
+}
+
+type openAIRequest struct {
+	Model          string                `json:"model"`
+	Messages       []openAIMessage       `json:"messages"`
+	Tools          []functionTool        `json:"tools,omitempty"`
+	Temperature    *float64              `json:"temperature,omitempty"`
+	TopP           *float64              `json:"top_p,omitempty"`
+	MaxTokens      *int                  `json:"max_tokens,omitempty"`
+	Seed           *int                  `json:"seed,omitempty"`
+	Stop           []string              `json:"stop,omitempty"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+	Stream         bool                  `json:"stream,omitempty"`
+}
+
+type openAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// openAIToolCall holds a tool call, whose arguments are sent as a string of JSON
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta        openAIMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func newOpenAIService(cfg map[string]string) (*openAIService, error) {
+	// parse once up front so that invalid config is caught at startup
+	if _, err := parseOpenAISettings(cfg); err != nil {
+		return nil, err
+	}
+
+	apiKey, err := health.OpenAIAPIKey(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to OpenAIAPIKey: %w", err)
+	}
+
+	client := &http.Client{}
+	if timeout, exists := cfg["timeout"]; exists {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to ParseDuration for config key 'timeout': %w", err)
+		}
+
+		client.Timeout = dur
+	}
+
+	o := &openAIService{
+		config: cfg,
+		apiKey: apiKey,
+		client: client,
+	}
+
+	return o, nil
+}
+
+func parseOpenAISettings(cfg map[string]string) (*openAISettings, error) {
+	model, exists := cfg["model"]
+	if !exists || model == "" {
+		return nil, errors.New("openai service missing config key: model")
+	}
+
+	baseURL := openAIDefaultBaseURL
+	if url, exists := cfg["baseURL"]; exists {
+		baseURL = strings.TrimSuffix(url, "/")
+	}
+
+	format := cfg["format"]
+	if format != "" && format != "json" {
+		return nil, fmt.Errorf("openai service has invalid format %s (must be json)", format)
+	}
+
+	s := &openAISettings{
+		baseURL: baseURL,
+		model:   model,
+		system:  cfg["system"],
+		format:  format,
+	}
+
+	for key, dest := range map[string]**float64{"temperature": &s.temperature, "topP": &s.topP} {
+		if val, exists := cfg[key]; exists {
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to ParseFloat for config key '%s' (must be decimal): %w", key, err)
+			}
+
+			*dest = &f
+		}
+	}
+
+	for key, dest := range map[string]**int{"maxTokens": &s.maxTokens, "seed": &s.seed} {
+		if val, exists := cfg[key]; exists {
+			i, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("failed to strconv.Atoi for config key '%s' (must be integer): %w", key, err)
+			}
+
+			*dest = &i
+		}
+	}
+
+	if stop, exists := cfg["stop"]; exists {
+		s.stop = strings.Split(strings.TrimSpace(stop), "\n")
+	}
+
+	return s, nil
+}
+
+// Completion generates a completion for the request's prompt or messages
+func (o *openAIService) Completion(ctx context.Context, req Request) (*Result, error) {
+	settings, err := parseOpenAISettings(mergeOptions(o.config, req.Options))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parseOpenAISettings: %w", err)
+	}
+
+	slog.Info("generating completion", "service", "openai", "model", settings.model)
+
+	url := settings.baseURL + "/chat/completions"
+
+	msgs := []openAIMessage{}
+	for _, m := range req.messages(settings.system) {
+		msgs = append(msgs, toOpenAIMessage(m))
+	}
+
+	reqBody := &openAIRequest{
+		Model:       settings.model,
+		Messages:    msgs,
+		Tools:       functionTools(req.Tools),
+		Temperature: settings.temperature,
+		TopP:        settings.topP,
+		MaxTokens:   settings.maxTokens,
+		Seed:        settings.seed,
+		Stop:        settings.stop,
+		Stream:      req.OnToken != nil,
+	}
+
+	if settings.format == "json" {
+		reqBody.ResponseFormat = &openAIResponseFormat{Type: "json_object"}
+	}
+
+	reqBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to json.Marshal: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to NewRequestWithContext: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Do: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
+	}
+
+	if req.OnToken != nil {
+		return readOpenAIStream(resp.Body, req.OnToken)
+	}
+
+	respBody := &openAIResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(respBody); err != nil {
+		return nil, fmt.Errorf("failed to NewDecoder.Decode: %w", err)
+	}
+
+	if len(respBody.Choices) == 0 {
+		return nil, errors.New("openai response contained no choices")
+	}
+
+	r := &Result{
+		Completion: respBody.Choices[0].Message.Content,
+		StopReason: respBody.Choices[0].FinishReason,
+	}
+
+	for _, tc := range respBody.Choices[0].Message.ToolCalls {
+		r.ToolCalls = append(r.ToolCalls, ToolCall{
+			ID:        tc.ID,
+			Name:      tc.Function.Name,
+			Arguments: json.RawMessage(tc.Function.Arguments),
+		})
+	}
+
+	if respBody.Usage != nil {
+		r.Usage = &Usage{
+			InputTokens:  respBody.Usage.PromptTokens,
+			OutputTokens: respBody.Usage.CompletionTokens,
+		}
+	}
+
+	return r, nil
+}
+
+// readOpenAIStream reads a streamed chat completion, which is sent as
+// Server-Sent Events containing deltas and terminated by a [DONE] message
+func readOpenAIStream(body io.Reader, onToken func(string) error) (*Result, error) {
+	r := &Result{}
+	completion := strings.Builder{}
+
+	errDone := errors.New("done")
+
+	err := readSSE(body, func(_, data string) error {
+		if data == "[DONE]" {
+			return errDone
+		}
+
+		chunk := &openAIStreamChunk{}
+		if err := json.Unmarshal([]byte(data), chunk); err != nil {
+			return fmt.Errorf("failed to json.Unmarshal: %w", err)
+		}
+
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+
+		if chunk.Choices[0].FinishReason != "" {
+			r.StopReason = chunk.Choices[0].FinishReason
+		}
+
+		token := chunk.Choices[0].Delta.Content
+		if token == "" {
+			return nil
+		}
+
+		completion.WriteString(token)
+
+		if err := onToken(token); err != nil {
+			return fmt.Errorf("failed to onToken: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errDone) {
+		return nil, fmt.Errorf("failed to readSSE: %w", err)
+	}
+
+	r.Completion = completion.String()
+
+	return r, nil
+}
+
+// Check checks that the API is reachable, accepts the API key, and serves the configured model
+func (o *openAIService) Check(ctx context.Context) error {
+	settings, err := parseOpenAISettings(o.config)
+	if err != nil {
+		return fmt.Errorf("failed to parseOpenAISettings: %w", err)
+	}
+
+	return health.CheckOpenAIModel(ctx, o.client, settings.baseURL, o.apiKey, settings.model)
+}
+
+func toOpenAIMessage(m Message) openAIMessage {
+	om := openAIMessage{
+		Role:       m.Role,
+		Content:    m.Content,
+		ToolCallID: m.ToolCallID,
+	}
+
+	for _, tc := range m.ToolCalls {
+		otc := openAIToolCall{ID: tc.ID, Type: "function"}
+		otc.Function.Name = tc.Name
+		otc.Function.Arguments = string(tc.Arguments)
+
+		om.ToolCalls = append(om.ToolCalls, otc)
+	}
+
+	return om
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cohix/ragoo/pkg/health"
+)
+
+// fakeOpenAI serves /chat/completions with the given status and body, recording each request
+type fakeOpenAI struct {
+	status int
+	body   string
+
+	auth string
+	req  openAIRequest
+}
+
+func (f *fakeOpenAI) start(t *testing.T) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+
+		f.auth = r.Header.Get("Authorization")
+
+		if err := json.NewDecoder(r.Body).Decode(&f.req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(f.status)
+		fmt.Fprint(w, f.body)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv.URL + "/v1"
+}
+
+func newTestOpenAIService(t *testing.T, cfg map[string]string) Service {
+	t.Helper()
+
+	srv, err := ServiceOfType("openai", cfg)
+	if err != nil {
+		t.Fatalf("failed to ServiceOfType: %s", err)
+	}
+
+	return srv
+}
+
+func TestOpenAICompletion(t *testing.T) {
+	t.Setenv(health.OpenAIDefaultAPIKeyEnv, "")
+
+	fake := &fakeOpenAI{
+		status: http.StatusOK,
+		body: `{
+			"choices": [{"message": {"role": "assistant", "content": "hello"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 7, "completion_tokens": 2}
+		}`,
+	}
+
+	srv := newTestOpenAIService(t, map[string]string{
+		"baseURL":     fake.start(t) + "/",
+		"model":       "gpt-test",
+		"system":      "be brief",
+		"temperature": "0.5",
+		"stop":        "END\nSTOP",
+	})
+
+	res, err := srv.Completion(context.Background(), Request{Prompt: "say hello", Options: map[string]string{"maxTokens": "10"}})
+	if err != nil {
+		t.Fatalf("failed to Completion: %s", err)
+	}
+
+	if res.Completion != "hello" || res.StopReason != "stop" {
+		t.Errorf("got completion %q with stop reason %q, want %q with %q", res.Completion, res.StopReason, "hello", "stop")
+	}
+
+	if res.Usage == nil || res.Usage.InputTokens != 7 || res.Usage.OutputTokens != 2 {
+		t.Errorf("got usage %+v, want 7 input and 2 output tokens", res.Usage)
+	}
+
+	req := fake.req
+	if req.Model != "gpt-test" || req.Stream {
+		t.Errorf("got model %q and stream %v, want gpt-test without streaming", req.Model, req.Stream)
+	}
+
+	if len(req.Messages) != 2 || req.Messages[0].Role != RoleSystem || req.Messages[0].Content != "be brief" ||
+		req.Messages[1].Role != RoleUser || req.Messages[1].Content != "say hello" {
+		t.Errorf("got messages %+v, want the system prompt followed by the user prompt", req.Messages)
+	}
+
+	if req.Temperature == nil || *req.Temperature != 0.5 {
+		t.Errorf("got temperature %v, want 0.5", req.Temperature)
+	}
+
+	if req.MaxTokens == nil || *req.MaxTokens != 10 {
+		t.Errorf("got max tokens %v, want 10 from the request options", req.MaxTokens)
+	}
+
+	if strings.Join(req.Stop, ",") != "END,STOP" {
+		t.Errorf("got stop %q, want [END STOP]", req.Stop)
+	}
+}
+
+func TestOpenAIChat(t *testing.T) {
+	t.Setenv(health.OpenAIDefaultAPIKeyEnv, "")
+
+	fake := &fakeOpenAI{
+		status: http.StatusOK,
+		body: `{
+			"choices": [{
+				"message": {
+					"role": "assistant",
+					"content": "",
+					"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"go\"}"}}]
+				},
+				"finish_reason": "tool_calls"
+			}]
+		}`,
+	}
+
+	srv := newTestOpenAIService(t, map[string]string{"baseURL": fake.start(t), "model": "gpt-test", "system": "be brief"})
+
+	msgs := []Message{
+		{Role: RoleSystem, Content: "you are a librarian"},
+		{Role: RoleUser, Content: "find go"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_0", Name: "lookup", Arguments: json.RawMessage(`{"q":"golang"}`)}}},
+		{Role: RoleTool, Content: "nothing found", ToolCallID: "call_0"},
+	}
+
+	tools := []ToolSpec{{Name: "lookup", Description: "looks things up", Parameters: map[string]any{"type": "object"}}}
+
+	res, err := srv.Completion(context.Background(), Request{Messages: msgs, Tools: tools})
+	if err != nil {
+		t.Fatalf("failed to Completion: %s", err)
+	}
+
+	if res.StopReason != "tool_calls" || len(res.ToolCalls) != 1 {
+		t.Fatalf("got stop reason %q and tool calls %+v, want one tool call", res.StopReason, res.ToolCalls)
+	}
+
+	if tc := res.ToolCalls[0]; tc.ID != "call_1" || tc.Name != "lookup" || string(tc.Arguments) != `{"q":"go"}` {
+		t.Errorf("got tool call %+v with arguments %s", tc, tc.Arguments)
+	}
+
+	req := fake.req
+	if len(req.Messages) != len(msgs) || req.Messages[0].Content != "you are a librarian" {
+		t.Fatalf("got messages %+v, want the request's messages without the configured system prompt", req.Messages)
+	}
+
+	if call := req.Messages[2].ToolCalls; len(call) != 1 || call[0].ID != "call_0" || call[0].Type != "function" || call[0].Function.Arguments != `{"q":"golang"}` {
+		t.Errorf("got assistant tool calls %+v", call)
+	}
+
+	if req.Messages[3].Role != RoleTool || req.Messages[3].ToolCallID != "call_0" {
+		t.Errorf("got tool message %+v", req.Messages[3])
+	}
+
+	if len(req.Tools) != 1 || req.Tools[0].Function.Name != "lookup" {
+		t.Errorf("got tools %+v, want lookup", req.Tools)
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	t.Setenv(health.OpenAIDefaultAPIKeyEnv, "")
+
+	fake := &fakeOpenAI{
+		status: http.StatusOK,
+		body: "data: {\"choices\": [{\"delta\": {\"content\": \"hel\"}}]}\n\n" +
+			"data: {\"choices\": [{\"delta\": {\"content\": \"lo\"}, \"finish_reason\": \"stop\"}]}\n\n" +
+			"data: [DONE]\n\n",
+	}
+
+	srv := newTestOpenAIService(t, map[string]string{"baseURL": fake.start(t), "model": "gpt-test"})
+
+	tokens := []string{}
+
+	res, err := srv.Completion(context.Background(), Request{
+		Prompt: "say hello",
+		OnToken: func(token string) error {
+			tokens = append(tokens, token)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to Completion: %s", err)
+	}
+
+	if !fake.req.Stream {
+		t.Error("request did not ask for streaming")
+	}
+
+	if res.Completion != "hello" || res.StopReason != "stop" || strings.Join(tokens, "|") != "hel|lo" {
+		t.Errorf("got completion %q, stop reason %q, and tokens %q", res.Completion, res.StopReason, tokens)
+	}
+}
+
+func TestOpenAIAuthHeader(t *testing.T) {
+	cases := []struct {
+		name     string
+		env      map[string]string
+		cfg      map[string]string
+		wantAuth string
+		wantErr  bool
+	}{
+		{
+			name:     "default env var",
+			env:      map[string]string{health.OpenAIDefaultAPIKeyEnv: "sk-default"},
+			wantAuth: "Bearer sk-default",
+		},
+		{
+			name:     "no key for local gateways",
+			env:      map[string]string{health.OpenAIDefaultAPIKeyEnv: ""},
+			wantAuth: "",
+		},
+		{
+			name:     "explicit env var",
+			env:      map[string]string{health.OpenAIDefaultAPIKeyEnv: "sk-default", "RAGOO_TEST_KEY": "sk-explicit"},
+			cfg:      map[string]string{"apiKeyEnv": "RAGOO_TEST_KEY"},
+			wantAuth: "Bearer sk-explicit",
+		},
+		{
+			name:    "explicit env var is empty",
+			env:     map[string]string{"RAGOO_TEST_KEY": ""},
+			cfg:     map[string]string{"apiKeyEnv": "RAGOO_TEST_KEY"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			fake := &fakeOpenAI{
+				status: http.StatusOK,
+				body:   `{"choices": [{"message": {"role": "assistant", "content": "ok"}}]}`,
+			}
+
+			cfg := map[string]string{"baseURL": fake.start(t), "model": "gpt-test"}
+			for k, v := range tc.cfg {
+				cfg[k] = v
+			}
+
+			srv, err := ServiceOfType("openai", cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("ServiceOfType succeeded, want error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to ServiceOfType: %s", err)
+			}
+
+			if _, err := srv.Completion(context.Background(), Request{Prompt: "hi"}); err != nil {
+				t.Fatalf("failed to Completion: %s", err)
+			}
+
+			if fake.auth != tc.wantAuth {
+				t.Errorf("got Authorization %q, want %q", fake.auth, tc.wantAuth)
+			}
+		})
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	t.Setenv(health.OpenAIDefaultAPIKeyEnv, "")
+
+	cases := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, body: `{"error": {"message": "bad key"}}`, wantErr: "non-200 status code: 401"},
+		{name: "rate limited", status: http.StatusTooManyRequests, body: `{}`, wantErr: "non-200 status code: 429"},
+		{name: "server error", status: http.StatusInternalServerError, body: `oops`, wantErr: "non-200 status code: 500"},
+		{name: "no choices", status: http.StatusOK, body: `{"choices": []}`, wantErr: "no choices"},
+		{name: "invalid body", status: http.StatusOK, body: `not json`, wantErr: "failed to NewDecoder.Decode"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeOpenAI{status: tc.status, body: tc.body}
+
+			srv := newTestOpenAIService(t, map[string]string{"baseURL": fake.start(t), "model": "gpt-test"})
+
+			_, err := srv.Completion(context.Background(), Request{Prompt: "hi"})
+			if err == nil {
+				t.Fatalf("Completion succeeded, want error containing %q", tc.wantErr)
+			}
+
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %q, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -1,20 +1,233 @@
 package service
 
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
 // Service represents an LLM service
 type Service interface {
-	Completion(prompt string) (*Result, error)
+	Completion(ctx context.Context, req Request) (*Result, error)
+}
+
+// Roles used in conversation messages
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message is a single role-tagged message in a conversation. Assistant messages may carry the
+// tool calls made by the model, and tool messages carry the result of one of those calls
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	ToolName   string     `json:"tool_name,omitempty"`
+}
+
+// ToolSpec describes a tool that the model may call
+type ToolSpec struct {
+	Name        string
+	Description string
+	Parameters  map[string]any // JSON schema for the tool's arguments
+}
+
+// ToolCall is a request from the model to call a tool with the given JSON arguments
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
 }
 
-// Result is the result of an embedder
+// Request is a request to an LLM service, containing either a single prompt or a list of messages
+type Request struct {
+	Prompt   string
+	Messages []Message
+	// Options override the service's config for a single request (e.g. from step params)
+	Options map[string]string
+	// Tools are made available for the model to call, in which case the Result may contain ToolCalls
+	Tools []ToolSpec
+	// OnToken, if set, causes the service to stream its completion, calling OnToken for each
+	// token as it arrives. The full completion is still returned in the Result
+	OnToken func(token string) error
+}
+
+// Result is the result of a service
 type Result struct {
 	Completion string
+	StopReason string
+	ToolCalls  []ToolCall
+	Usage      *Usage
+}
+
+// Usage reports the tokens consumed by a service request, if the service provides it
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// Constructor creates a service from its config
+type Constructor func(config map[string]string) (Service, error)
+
+var (
+	registry = map[string]Constructor{
+		"ollama": func(config map[string]string) (Service, error) {
+			srv, err := newOllamaService(config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to newOllamaService: %w", err)
+			}
+
+			return srv, nil
+		},
+		"openai": func(config map[string]string) (Service, error) {
+			srv, err := newOpenAIService(config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to newOpenAIService: %w", err)
+			}
+
+			return srv, nil
+		},
+		"anthropic": func(config map[string]string) (Service, error) {
+			srv, err := newAnthropicService(config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to newAnthropicService: %w", err)
+			}
+
+			return srv, nil
+		},
+	}
+	registryLock = sync.RWMutex{} // protect access to the registry for concurrent access
+)
+
+// Register makes a service type available for use in config, replacing any existing type with the same name
+func Register(srvType string, constructor Constructor) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[srvType] = constructor
 }
 
-// ServiceOfType returns a service for the provided type
-func ServiceOfType(strType string, config map[string]string) Service {
-	switch strType {
-	case "ollama":
-		return &ollamaService{config}
+// ServiceOfType returns a service for the provided type, or an error if
+// the type is unknown or the config is invalid
+func ServiceOfType(srvType string, config map[string]string) (Service, error) {
+	registryLock.RLock()
+	constructor, exists := registry[srvType]
+	registryLock.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("service of type %s not found", srvType)
+	}
+
+	return constructor(config)
+}
+
+// messages returns the request's messages (or a single user message containing its prompt),
+// preceded by the given system prompt unless it is empty or the messages already contain one
+func (r Request) messages(system string) []Message {
+	msgs := r.Messages
+	if len(msgs) == 0 {
+		msgs = []Message{{Role: RoleUser, Content: r.Prompt}}
+	}
+
+	if system == "" {
+		return msgs
+	}
+
+	for _, m := range msgs {
+		if m.Role == RoleSystem {
+			return msgs
+		}
+	}
+
+	return append([]Message{{Role: RoleSystem, Content: system}}, msgs...)
+}
+
+// functionTool is the tool format shared by the ollama and openai APIs
+type functionTool struct {
+	Type     string       `json:"type"`
+	Function functionSpec `json:"function"`
+}
+
+type functionSpec struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+func functionTools(specs []ToolSpec) []functionTool {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	tools := make([]functionTool, len(specs))
+	for i, s := range specs {
+		tools[i] = functionTool{
+			Type:     "function",
+			Function: functionSpec{Name: s.Name, Description: s.Description, Parameters: s.Parameters},
+		}
+	}
+
+	return tools
+}
+
+// mergeOptions returns a copy of config with opts applied over it
+func mergeOptions(config, opts map[string]string) map[string]string {
+	merged := make(map[string]string, len(config)+len(opts))
+
+	for k, v := range config {
+		merged[k] = v
+	}
+
+	for k, v := range opts {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// readSSE reads a Server-Sent Events stream from r, calling fn with the event name
+// and data of each event until the stream ends or fn returns an error
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	event := ""
+	data := []string{}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := fn(event, strings.Join(data, "\n")); err != nil {
+					return err
+				}
+			}
+
+			event = ""
+			data = []string{}
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to scanner.Scan: %w", err)
+	}
+
+	if len(data) > 0 {
+		return fn(event, strings.Join(data, "\n"))
 	}
 
 	return nil
@@ -3,12 +3,13 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"time"
+	"sync"
 
 	"github.com/pgvector/pgvector-go"
 
@@ -16,50 +17,51 @@ import (
 )
 
 type duckDBStorage struct {
-	config  map[string]string
-	db      *sql.DB
-	created map[string]bool
+	config          map[string]string
+	db              *sql.DB
+	created         map[string]bool
+	sessionsCreated bool
+	lock            sync.Mutex // protect db, created, and sessionsCreated as steps may run concurrently
 }
 
-func (d *duckDBStorage) InsertEmbedding(collection string, ref string, embedding []float32, batch string) (*Result, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
+func (d *duckDBStorage) InsertEmbedding(ctx context.Context, collection string, ref string, chunk string, embedding []float32, batch string) (*Result, error) {
 	conn, err := d.ensureDB(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to ensureDB: %w", err)
 	}
 
-	if _, exists := d.created[collection]; !exists {
-		if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS collection_%s (embedding DOUBLE[], ref VARCHAR, batch VARCHAR);", collection)); err != nil {
-			return nil, fmt.Errorf("failed to Exec: %w", err)
-		}
+	defer conn.Close()
 
-		d.created[collection] = true
+	if err := d.ensureCollection(ctx, conn, collection); err != nil {
+		return nil, fmt.Errorf("failed to ensureCollection: %w", err)
 	}
 
-	if _, err := conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO collection_%s (embedding, ref, batch) VALUES (?, ?, ?);", collection), pgvector.NewVector(embedding), ref, batch); err != nil {
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO collection_%s (embedding, ref, chunk, batch) VALUES (?, ?, ?, ?);", collection), pgvector.NewVector(embedding), ref, chunk, batch); err != nil {
 		return nil, fmt.Errorf("failed to Exec: %w", err)
 	}
 
 	return &Result{}, nil
 }
 
-func (d *duckDBStorage) LookupCosine(collection string, embedding []float32, limit int, threshold float32) (*Result, error) {
+func (d *duckDBStorage) LookupCosine(ctx context.Context, collection string, embedding []float32, limit int, threshold float32) (*Result, error) {
 	slog.Info("cosine lookup", "storage", "duckdb")
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
 	conn, err := d.ensureDB(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to ensureDB: %w", err)
 	}
 
+	defer conn.Close()
+
+	if err := d.ensureCollection(ctx, conn, collection); err != nil {
+		return nil, fmt.Errorf("failed to ensureCollection: %w", err)
+	}
+
+	// each ref is returned once, with the chunk that matched best
 	res, err := conn.QueryContext(ctx, fmt.Sprintf(`
-	SELECT ref, MAX(cosine) as max_cosine
+	SELECT ref, MAX(cosine) as max_cosine, arg_max(chunk, cosine) as best_chunk
 		FROM(
-				SELECT ref, list_cosine_similarity(embedding, ?) as cosine 
+				SELECT ref, chunk, list_cosine_similarity(embedding, ?) as cosine 
 				FROM collection_%s 
 				WHERE cosine > ? 
 			)
@@ -76,32 +78,38 @@ func (d *duckDBStorage) LookupCosine(collection string, embedding []float32, lim
 	result := &Result{
 		Refs:    []string{},
 		Cosines: []float32{},
+		Chunks:  []string{},
 	}
 
 	for res.Next() {
 		var ref string
 		var cosine float32
-		if err := res.Scan(&ref, &cosine); err != nil {
+		var chunk sql.NullString // rows inserted before chunks were stored have none
+		if err := res.Scan(&ref, &cosine, &chunk); err != nil {
 			return nil, fmt.Errorf("failed to res.Scan: %w", err)
 		}
 
 		result.Refs = append(result.Refs, ref)
 		result.Cosines = append(result.Cosines, cosine)
+		result.Chunks = append(result.Chunks, chunk.String)
 	}
 
 	return result, nil
 }
 
 // Cleanup cleans up old data
-func (d *duckDBStorage) Cleanup(collection string, batch string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
+func (d *duckDBStorage) Cleanup(ctx context.Context, collection string, batch string) error {
 	conn, err := d.ensureDB(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to ensureDB: %w", err)
 	}
 
+	defer conn.Close()
+
+	if err := d.ensureCollection(ctx, conn, collection); err != nil {
+		return fmt.Errorf("failed to ensureCollection: %w", err)
+	}
+
 	if _, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM collection_%s WHERE batch != ?;", collection), batch); err != nil {
 		return fmt.Errorf("failed to Exec: %w", err)
 	}
@@ -109,29 +117,252 @@ func (d *duckDBStorage) Cleanup(collection string, batch string) error {
 	return nil
 }
 
-func (d *duckDBStorage) ensureDB(ctx context.Context) (*sql.Conn, error) {
-	if d.db == nil {
-		dbFile, exists := d.config["dbFilePath"]
-		if !exists {
-			return nil, errors.New("storage of type duckdb missing config key: dbFilePath")
+// AppendTurn records a turn at the end of the given session
+func (d *duckDBStorage) AppendTurn(ctx context.Context, session string, turn Turn) error {
+	conn, err := d.ensureDB(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to ensureDB: %w", err)
+	}
+
+	defer conn.Close()
+
+	if err := d.ensureSessions(ctx, conn); err != nil {
+		return fmt.Errorf("failed to ensureSessions: %w", err)
+	}
+
+	refs, err := json.Marshal(turn.Refs)
+	if err != nil {
+		return fmt.Errorf("failed to json.Marshal: %w", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "INSERT INTO sessions (session, input, response, refs, created) VALUES (?, ?, ?, ?, ?);", session, turn.Input, turn.Response, string(refs), turn.Created); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+
+	return nil
+}
+
+// LoadTurns returns the most recent turns of the given session in chronological order,
+// up to limit turns (or all of them if limit is zero)
+func (d *duckDBStorage) LoadTurns(ctx context.Context, session string, limit int) ([]Turn, error) {
+	conn, err := d.ensureDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ensureDB: %w", err)
+	}
+
+	defer conn.Close()
+
+	if err := d.ensureSessions(ctx, conn); err != nil {
+		return nil, fmt.Errorf("failed to ensureSessions: %w", err)
+	}
+
+	// the sequence numbers are computed over the whole session, before the limit applies
+	query := "SELECT row_number() OVER (ORDER BY created) AS seq, input, response, refs, created FROM sessions WHERE session = ? ORDER BY created DESC"
+	args := []any{session}
+
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	res, err := conn.QueryContext(ctx, query+";", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Query: %w", err)
+	}
+
+	defer res.Close()
+
+	turns := []Turn{}
+
+	for res.Next() {
+		var turn Turn
+		var refs string
+		if err := res.Scan(&turn.Seq, &turn.Input, &turn.Response, &refs, &turn.Created); err != nil {
+			return nil, fmt.Errorf("failed to res.Scan: %w", err)
 		}
 
-		if err := os.MkdirAll(filepath.Dir(filepath.Clean(dbFile)), os.FileMode(0o700)); err != nil {
-			return nil, fmt.Errorf("failed to MkdirAll: %w", err)
+		if err := json.Unmarshal([]byte(refs), &turn.Refs); err != nil {
+			return nil, fmt.Errorf("failed to json.Unmarshal: %w", err)
 		}
 
-		db, err := sql.Open("duckdb", filepath.Clean(dbFile))
-		if err != nil {
-			return nil, fmt.Errorf("failed to sql.Open: %w", err)
+		turns = append(turns, turn)
+	}
+
+	if err := res.Err(); err != nil {
+		return nil, fmt.Errorf("failed to res.Next: %w", err)
+	}
+
+	// reverse into chronological order
+	for i, j := 0, len(turns)-1; i < j; i, j = i+1, j-1 {
+		turns[i], turns[j] = turns[j], turns[i]
+	}
+
+	return turns, nil
+}
+
+// LoadSummary returns the saved summary of the given session, or nil if it has none
+func (d *duckDBStorage) LoadSummary(ctx context.Context, session string) (*Summary, error) {
+	conn, err := d.ensureDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ensureDB: %w", err)
+	}
+
+	defer conn.Close()
+
+	if err := d.ensureSessions(ctx, conn); err != nil {
+		return nil, fmt.Errorf("failed to ensureSessions: %w", err)
+	}
+
+	summary := &Summary{}
+
+	row := conn.QueryRowContext(ctx, "SELECT summary, turns, updated FROM session_summaries WHERE session = ?;", session)
+	if err := row.Scan(&summary.Text, &summary.Turns, &summary.Updated); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
 		}
 
-		d.db = db
+		return nil, fmt.Errorf("failed to row.Scan: %w", err)
+	}
+
+	return summary, nil
+}
+
+// SaveSummary saves the summary of the given session, replacing any previous one
+func (d *duckDBStorage) SaveSummary(ctx context.Context, session string, summary Summary) error {
+	conn, err := d.ensureDB(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to ensureDB: %w", err)
+	}
+
+	defer conn.Close()
+
+	if err := d.ensureSessions(ctx, conn); err != nil {
+		return fmt.Errorf("failed to ensureSessions: %w", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "INSERT OR REPLACE INTO session_summaries (session, summary, turns, updated) VALUES (?, ?, ?, ?);", session, summary.Text, summary.Turns, summary.Updated); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
 	}
 
-	conn, err := d.db.Conn(ctx)
+	return nil
+}
+
+func (d *duckDBStorage) ensureCollection(ctx context.Context, conn *sql.Conn, collection string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if _, exists := d.created[collection]; exists {
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS collection_%s (embedding DOUBLE[], ref VARCHAR, chunk VARCHAR, batch VARCHAR);", collection)); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+
+	// collections created before chunks were stored need the column adding
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE collection_%s ADD COLUMN IF NOT EXISTS chunk VARCHAR;", collection)); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+
+	d.created[collection] = true
+
+	return nil
+}
+
+func (d *duckDBStorage) ensureSessions(ctx context.Context, conn *sql.Conn) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.sessionsCreated {
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS sessions (session VARCHAR, input VARCHAR, response VARCHAR, refs VARCHAR, created TIMESTAMP);"); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS session_summaries (session VARCHAR PRIMARY KEY, summary VARCHAR, turns INTEGER, updated TIMESTAMP);"); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+
+	d.sessionsCreated = true
+
+	return nil
+}
+
+func (d *duckDBStorage) ensureDB(ctx context.Context) (*sql.Conn, error) {
+	db, err := d.openDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to openDB: %w", err)
+	}
+
+	conn, err := db.Conn(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to db.Conn: %w", err)
 	}
 
 	return conn, nil
 }
+
+// Check opens the database (if it isn't already) and checks that it responds to queries
+func (d *duckDBStorage) Check(ctx context.Context) error {
+	conn, err := d.ensureDB(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to ensureDB: %w", err)
+	}
+
+	defer conn.Close()
+
+	if err := conn.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to PingContext: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the database, if it is open
+func (d *duckDBStorage) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.db == nil {
+		return nil
+	}
+
+	err := d.db.Close()
+	d.db = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to db.Close: %w", err)
+	}
+
+	return nil
+}
+
+// openDB opens the database the first time it is called, and returns the same handle thereafter
+func (d *duckDBStorage) openDB() (*sql.DB, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.db != nil {
+		return d.db, nil
+	}
+
+	dbFile, exists := d.config["dbFilePath"]
+	if !exists {
+		return nil, errors.New("storage of type duckdb missing config key: dbFilePath")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filepath.Clean(dbFile)), os.FileMode(0o700)); err != nil {
+		return nil, fmt.Errorf("failed to MkdirAll: %w", err)
+	}
+
+	db, err := sql.Open("duckdb", filepath.Clean(dbFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sql.Open: %w", err)
+	}
+
+	d.db = db
+
+	return db, nil
+}
@@ -1,49 +1,104 @@
 package storage
 
 import (
-	"log/slog"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"sync"
+	"time"
 )
 
 var (
 	active = map[string]map[string]Storage{} // store active storage by type and name
 	lock   = sync.Mutex{}                    // protect access to active storage for concurrent access
+
+	registry = map[string]Constructor{
+		"duckdb": func(config map[string]string) (Storage, error) {
+			return &duckDBStorage{config: config, created: map[string]bool{}}, nil
+		},
+	}
+	registryLock = sync.RWMutex{} // protect access to the registry for concurrent access
 )
 
-// Storage represents an embedder
+// Constructor creates storage from its config
+type Constructor func(config map[string]string) (Storage, error)
+
+// Register makes a storage type available for use in config, replacing any existing type with the same name
+func Register(stType string, constructor Constructor) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[stType] = constructor
+}
+
+// Storage represents an embedder. Storage that holds resources such as open files should also
+// implement io.Closer, so that they can be released by CloseAll, storage that can check it is
+// usable (e.g. that its database opens) should implement health.Checker, and storage that can
+// persist conversation sessions should implement SessionStore
 type Storage interface {
-	InsertEmbedding(collection string, ref string, embedding []float32, batch string) (*Result, error)
-	LookupCosine(collection string, embedding []float32, limit int, threshold float32) (*Result, error)
-	Cleanup(collection string, batch string) error
+	InsertEmbedding(ctx context.Context, collection string, ref string, chunk string, embedding []float32, batch string) (*Result, error)
+	LookupCosine(ctx context.Context, collection string, embedding []float32, limit int, threshold float32) (*Result, error)
+	Cleanup(ctx context.Context, collection string, batch string) error
 }
 
-// Result is the result of an embedder
+// SessionStore is implemented by storage that can persist conversation sessions, and is
+// required of the storage used by a route's session
+type SessionStore interface {
+	AppendTurn(ctx context.Context, session string, turn Turn) error
+	LoadTurns(ctx context.Context, session string, limit int) ([]Turn, error)
+	LoadSummary(ctx context.Context, session string) (*Summary, error)
+	SaveSummary(ctx context.Context, session string, summary Summary) error
+}
+
+// Result is the result of an embedder. For lookups, Chunks holds the text that matched for each ref
 type Result struct {
 	Refs    []string
 	Cosines []float32
+	Chunks  []string
+}
+
+// Turn is a single exchange in a persisted conversation session. Seq is its position in the
+// session, starting from 1, and is set by LoadTurns
+type Turn struct {
+	Seq      int       `json:"seq"`
+	Input    string    `json:"input"`
+	Response string    `json:"response"`
+	Refs     []string  `json:"refs,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+// Summary is a persisted summary of the first Turns turns of a conversation session
+type Summary struct {
+	Text    string    `json:"text"`
+	Turns   int       `json:"turns"`
+	Updated time.Time `json:"updated"`
 }
 
-// StorageOfType returns storage for the provided type
-func StorageOfType(name, stType string, config map[string]string) Storage {
+// StorageOfType returns the named storage, creating it for the provided type the first time it is
+// used, or an error if the type is unknown or the config is invalid
+func StorageOfType(name, stType string, config map[string]string) (Storage, error) {
 	lock.Lock()
 	defer lock.Unlock()
 
 	// first check to see if storage of the given type and name is already active
 	if actType, exists := active[stType]; exists {
 		if str, exists := actType[name]; exists {
-			return str
+			return str, nil
 		}
 	}
 
-	var str Storage
-	switch stType {
-	case "duckdb":
-		str = &duckDBStorage{config, nil, map[string]bool{}}
+	registryLock.RLock()
+	constructor, exists := registry[stType]
+	registryLock.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("storage of type %s not found", stType)
 	}
 
-	if str == nil {
-		slog.Warn("no storage found for", "type", stType, "name", name)
-		return nil
+	str, err := constructor(config)
+	if err != nil {
+		return nil, err
 	}
 
 	if actType, exists := active[stType]; exists {
@@ -52,5 +107,28 @@ func StorageOfType(name, stType string, config map[string]string) Storage {
 		active[stType] = map[string]Storage{name: str}
 	}
 
-	return str
+	return str, nil
+}
+
+// CloseAll closes all active storage that implements io.Closer, such as DuckDB databases, and forgets
+// it, so that it is reopened if used again. It should be called once nothing is using storage
+func CloseAll() error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	errs := []error{}
+
+	for stType, byName := range active {
+		for name, str := range byName {
+			if closer, ok := str.(io.Closer); ok {
+				if err := closer.Close(); err != nil {
+					errs = append(errs, fmt.Errorf("failed to Close storage %s: %w", name, err))
+				}
+			}
+		}
+
+		delete(active, stType)
+	}
+
+	return errors.Join(errs...)
 }
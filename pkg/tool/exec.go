@@ -0,0 +1,105 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const execDefaultTimeout = 30 * time.Second
+
+// execTool runs a local binary, writing the tool arguments to its stdin as JSON
+// and returning its stdout (JSON or plain text) to the model
+type execTool struct {
+	command string
+	args    []string
+	dir     string
+	timeout time.Duration
+}
+
+// newExecTool creates an exec tool from its config, which supports the keys
+// command (required), args (one per line), dir, and timeout
+func newExecTool(cfg map[string]string) (*execTool, error) {
+	command, exists := cfg["command"]
+	if !exists || command == "" {
+		return nil, errors.New("exec tool missing config key: command")
+	}
+
+	if _, err := exec.LookPath(command); err != nil {
+		return nil, fmt.Errorf("failed to LookPath for command %s: %w", command, err)
+	}
+
+	e := &execTool{
+		command: command,
+		dir:     cfg["dir"],
+		timeout: execDefaultTimeout,
+	}
+
+	if args, exists := cfg["args"]; exists && strings.TrimSpace(args) != "" {
+		e.args = strings.Split(strings.TrimSpace(args), "\n")
+	}
+
+	if timeout, exists := cfg["timeout"]; exists {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to ParseDuration for config key 'timeout': %w", err)
+		}
+
+		e.timeout = dur
+	}
+
+	return e, nil
+}
+
+// Call runs the command with args on its stdin. A non-zero exit code is reported
+// to the model as a tool error rather than returned as an error
+func (e *execTool) Call(ctx context.Context, args json.RawMessage) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	cmd := exec.CommandContext(ctx, e.command, e.args...)
+	cmd.Dir = e.dir
+	cmd.Stdin = bytes.NewReader(args)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+
+	if stderr.Len() > 0 {
+		slog.Info("exec tool stderr", "command", e.command, "stderr", strings.TrimSpace(stderr.String()))
+	}
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("command %s did not complete: %w", e.command, ctx.Err())
+	}
+
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) {
+		output := strings.TrimSpace(stdout.String())
+		if output == "" {
+			output = strings.TrimSpace(stderr.String())
+		}
+
+		return &Result{
+			Output:  fmt.Sprintf("command exited with code %d: %s", exitErr.ExitCode(), output),
+			IsError: true,
+		}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to cmd.Run: %w", err)
+	}
+
+	return &Result{Output: strings.TrimSpace(stdout.String())}, nil
+}
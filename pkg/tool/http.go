@@ -0,0 +1,224 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	httpDefaultTimeout = 30 * time.Second
+	httpMaxResponse    = 1024 * 1024
+)
+
+// httpTool calls an HTTP endpoint, rendering the URL and body from the tool arguments
+// and returning the response body to the model
+type httpTool struct {
+	method      string
+	url         *template.Template
+	templateURL bool
+	body        *template.Template
+	headers     map[string]string
+	client      *http.Client
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"query": url.QueryEscape,
+}
+
+// newHTTPTool creates an http tool from its config, which supports the keys url (required),
+// method, body, timeout, and any number of headers.<name> keys. The url and body are Go templates
+// rendered with the tool arguments (e.g. {{.id}}, {{json .filters}}), and header values may reference
+// env vars (e.g. Bearer ${API_TOKEN}). Without a body template, the arguments are sent as the JSON body,
+// or for GET requests as query params (unless the url is itself a template)
+func newHTTPTool(cfg map[string]string) (*httpTool, error) {
+	rawURL, exists := cfg["url"]
+	if !exists || rawURL == "" {
+		return nil, errors.New("http tool missing config key: url")
+	}
+
+	urlTmpl, err := template.New("url").Funcs(templateFuncs).Option("missingkey=error").Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Parse url template: %w", err)
+	}
+
+	h := &httpTool{
+		method:      http.MethodPost,
+		url:         urlTmpl,
+		templateURL: strings.Contains(rawURL, "{{"),
+		headers:     map[string]string{},
+		client:      &http.Client{Timeout: httpDefaultTimeout},
+	}
+
+	if method, exists := cfg["method"]; exists {
+		h.method = strings.ToUpper(method)
+	}
+
+	if body, exists := cfg["body"]; exists {
+		bodyTmpl, err := template.New("body").Funcs(templateFuncs).Option("missingkey=error").Parse(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to Parse body template: %w", err)
+		}
+
+		h.body = bodyTmpl
+	}
+
+	for k, v := range cfg {
+		if !strings.HasPrefix(k, "headers.") {
+			continue
+		}
+
+		val, err := expandEnv(v)
+		if err != nil {
+			return nil, fmt.Errorf("http tool header %s is invalid: %w", strings.TrimPrefix(k, "headers."), err)
+		}
+
+		h.headers[strings.TrimPrefix(k, "headers.")] = val
+	}
+
+	if timeout, exists := cfg["timeout"]; exists {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to ParseDuration for config key 'timeout': %w", err)
+		}
+
+		h.client.Timeout = dur
+	}
+
+	return h, nil
+}
+
+// Call makes the HTTP request for the given args. A non-2xx response is reported
+// to the model as a tool error rather than returned as an error
+func (h *httpTool) Call(ctx context.Context, args json.RawMessage) (*Result, error) {
+	argMap := map[string]any{}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &argMap); err != nil {
+			return &Result{Output: fmt.Sprintf("arguments are not a JSON object: %s", err), IsError: true}, nil
+		}
+	}
+
+	reqURL, err := render(h.url, argMap)
+	if err != nil {
+		return &Result{Output: fmt.Sprintf("failed to build URL from arguments: %s", err), IsError: true}, nil
+	}
+
+	var body io.Reader
+	contentType := "application/json"
+
+	switch {
+	case h.body != nil:
+		rendered, err := render(h.body, argMap)
+		if err != nil {
+			return &Result{Output: fmt.Sprintf("failed to build body from arguments: %s", err), IsError: true}, nil
+		}
+
+		body = strings.NewReader(rendered)
+	case h.method == http.MethodGet && !h.templateURL:
+		reqURL, err = withQuery(reqURL, argMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to withQuery: %w", err)
+		}
+	case h.method == http.MethodGet:
+		// the arguments were rendered into the url
+	default:
+		body = bytes.NewReader(args)
+	}
+
+	slog.Info("calling http tool", "method", h.method, "url", reqURL)
+
+	req, err := http.NewRequestWithContext(ctx, h.method, reqURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to NewRequestWithContext: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Do: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxResponse))
+	if err != nil {
+		return nil, fmt.Errorf("failed to ReadAll: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &Result{
+			Output:  fmt.Sprintf("request failed with status code %d: %s", resp.StatusCode, strings.TrimSpace(string(respBytes))),
+			IsError: true,
+		}, nil
+	}
+
+	return &Result{Output: strings.TrimSpace(string(respBytes))}, nil
+}
+
+func render(tmpl *template.Template, data map[string]any) (string, error) {
+	buf := &strings.Builder{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// withQuery adds each top-level argument to the URL as a query param
+func withQuery(rawURL string, args map[string]any) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to url.Parse: %w", err)
+	}
+
+	q := u.Query()
+	for k, v := range args {
+		q.Set(k, fmt.Sprint(v))
+	}
+
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// expandEnv replaces $VAR and ${VAR} in s with the values of env vars, returning an error naming
+// any that are unset or empty, so that e.g. "Bearer ${API_TOKEN}" is never sent without its token
+func expandEnv(s string) (string, error) {
+	missing := []string{}
+
+	val := os.Expand(s, func(name string) string {
+		v := os.Getenv(name)
+		if v == "" {
+			missing = append(missing, name)
+		}
+
+		return v
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unset or empty env vars: %s", strings.Join(missing, ", "))
+	}
+
+	return val, nil
+}
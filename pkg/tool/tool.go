@@ -1,4 +1,75 @@
 package tool
 
-// Result is the result of a tool call
-type Result struct{}
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Tool represents a tool that can be called by an LLM
+type Tool interface {
+	Call(ctx context.Context, args json.RawMessage) (*Result, error)
+}
+
+// Result is the result of a tool call. IsError indicates that the tool ran but reported
+// a failure, which is passed back to the model rather than failing the workflow
+type Result struct {
+	Output  string `json:"output"`
+	IsError bool   `json:"isError,omitempty"`
+}
+
+// Func adapts a Go function into a Tool, for use with Register
+type Func func(ctx context.Context, args json.RawMessage) (*Result, error)
+
+// Call calls f
+func (f Func) Call(ctx context.Context, args json.RawMessage) (*Result, error) {
+	return f(ctx, args)
+}
+
+// Constructor creates a tool from its config
+type Constructor func(config map[string]string) (Tool, error)
+
+var (
+	registry = map[string]Constructor{
+		"exec": func(config map[string]string) (Tool, error) {
+			t, err := newExecTool(config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to newExecTool: %w", err)
+			}
+
+			return t, nil
+		},
+		"http": func(config map[string]string) (Tool, error) {
+			t, err := newHTTPTool(config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to newHTTPTool: %w", err)
+			}
+
+			return t, nil
+		},
+	}
+	registryLock = sync.RWMutex{} // protect access to the registry for concurrent access
+)
+
+// Register makes a tool type available for use in config, replacing any existing type with the same name
+func Register(toolType string, constructor Constructor) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[toolType] = constructor
+}
+
+// ToolOfType returns a tool for the provided type, or an error if
+// the type is unknown or the config is invalid
+func ToolOfType(toolType string, config map[string]string) (Tool, error) {
+	registryLock.RLock()
+	constructor, exists := registry[toolType]
+	registryLock.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("tool of type %s not found", toolType)
+	}
+
+	return constructor(config)
+}
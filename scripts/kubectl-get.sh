@@ -0,0 +1,10 @@
+#!/bin/sh
+# Example exec tool: reads {"kind": "<kind>"} on stdin and lists resources of that kind.
+kind=$(sed -n 's/.*"kind"[[:space:]]*:[[:space:]]*"\([a-zA-Z.]*\)".*/\1/p')
+
+if [ -z "$kind" ]; then
+	echo "missing argument: kind" >&2
+	exit 1
+fi
+
+exec kubectl get "$kind" -o name